@@ -13,9 +13,27 @@ import (
 	"github.com/graphql-go/graphql"
 )
 
-// Server implements graphql http handler with websocket support (if upgrader is provided with WithUpgrader)
+// Server implements graphql http handler with websocket support (using standard library websocket implementation,
+// unless other upgrader is provided with WithUpgrader)
 type Server interface {
 	http.Handler
+
+	// Shutdown gracefully shuts down the server, draining websocket connections and streamed HTTP responses, see
+	// WithShutdownCloseCode
+	Shutdown(ctx context.Context) error
+
+	// Connections returns active websocket connections
+	Connections() []ConnectionInfo
+
+	// CancelOperation cancels running operation of websocket connection, see ConnectionInfo.ID.
+	// Operation is completed if err is nil, otherwise terminated with err.
+	// Returns false if connection or operation is not found.
+	CancelOperation(connectionID, operationID string, err error) bool
+
+	// CloseConnection closes websocket connection with close code of provided error, which is then reported to
+	// OnDisconnect, e.g. apollows.EventUnauthorized or apollows.WrapError(err, apollows.EventUnauthorized).
+	// Returns false if connection is not found.
+	CloseConnection(connectionID string, err apollows.Error) bool
 }
 
 func initCallbacks(c *serverConfig) {
@@ -69,6 +87,10 @@ func initCallbacks(c *serverConfig) {
 		}
 	}
 
+	if c.callbacks.OnOverflow == nil {
+		c.callbacks.OnOverflow = func(opctx mutable.Context, policy OverflowPolicy) {}
+	}
+
 	if c.callbacks.OnOperationDone == nil {
 		c.callbacks.OnOperationDone = func(ctx mutable.Context, payload *apollows.PayloadOperation, err error) error {
 			return err
@@ -83,7 +105,7 @@ func NewServer(
 ) (Server, error) {
 	var c serverConfig
 
-	c.subscriptionProtocols = make(map[apollows.Protocol]struct{})
+	c.subscriptionProtocols = make(map[string]Protocol)
 
 	for _, o := range options {
 		err := o(&c)
@@ -93,8 +115,33 @@ func NewServer(
 	}
 
 	if len(c.subscriptionProtocols) == 0 {
-		c.subscriptionProtocols[apollows.WebsocketSubprotocolGraphqlWS] = struct{}{}
-		c.subscriptionProtocols[apollows.WebsocketSubprotocolGraphqlTransportWS] = struct{}{}
+		c.subscriptionProtocols[apollows.WebsocketSubprotocolGraphqlWS.String()] = apollows.WebsocketSubprotocolGraphqlWS
+		c.subscriptionProtocols[apollows.WebsocketSubprotocolGraphqlTransportWS.String()] =
+			apollows.WebsocketSubprotocolGraphqlTransportWS
+	}
+
+	if c.maxBatchSize <= 0 {
+		c.maxBatchSize = DefaultMaxBatchSize
+	}
+
+	if c.sseReservationTimeout <= 0 {
+		c.sseReservationTimeout = DefaultSSEReservationTimeout
+	}
+
+	if c.connectTimeout > 0 && c.connectTimeout < c.sseReservationTimeout {
+		c.sseReservationTimeout = c.connectTimeout
+	}
+
+	if c.maxSSEReservations <= 0 {
+		c.maxSSEReservations = DefaultMaxSSEReservations
+	}
+
+	if c.shutdownCloseCode == 0 {
+		c.shutdownCloseCode = apollows.EventGoingAway
+	}
+
+	if c.upgrader == nil && !c.rejectWebsocket {
+		c.upgrader = defaultUpgrader(c.subscriptionProtocols)
 	}
 
 	initCallbacks(&c)
@@ -107,6 +154,14 @@ func NewServer(
 	}
 
 	return &serverImpl{
+		sse: sseStreams{
+			streams: make(map[string]*sseStream),
+		},
+		connections: connections{
+			requests: make(map[*websocketRequest]struct{}),
+			streams:  make(map[mutable.Context]struct{}),
+			shutdown: make(chan struct{}),
+		},
 		schema:       schema,
 		extensions:   exts,
 		serverConfig: c,
@@ -138,7 +193,7 @@ type Callbacks struct {
 	OnDisconnect func(reqctx mutable.Context, origerr error) error
 
 	// OnOperation is called before each operation with original payload, allowing to modify it or terminate
-	// the operation by returning an error.
+	// the operation by returning an error. Query of persisted query is not yet resolved at this point.
 	OnOperation func(opctx mutable.Context, payload *apollows.PayloadOperation) error
 
 	// OnOperationValidation is called after parsing an operation payload with any immediate validation result, if
@@ -154,6 +209,10 @@ type Callbacks struct {
 	// By default, will pass through any error occurred. AST will be available in context with ContextAST if can be
 	// parsed.
 	OnOperationDone func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error
+
+	// OnOverflow is called each time websocket operation result does not fit into outgoing buffer and overflow
+	// policy other than OverflowBlock is applied, see WithOverflowPolicy.
+	OnOverflow func(opctx mutable.Context, policy OverflowPolicy)
 }
 
 // ServerOption to configure Server
@@ -168,10 +227,11 @@ func WithUpgrader(upgrader Upgrader) ServerOption {
 	}
 }
 
-// WithCallbacks option sets callbacks handling various stages of requests
+// WithCallbacks option sets callbacks handling various stages of requests. May be specified multiple times,
+// callbacks are combined with ChainCallbacks in order of options.
 func WithCallbacks(callbacks Callbacks) ServerOption {
 	return func(config *serverConfig) error {
-		config.callbacks = callbacks
+		config.callbacks = ChainCallbacks(config.callbacks, callbacks)
 
 		return nil
 	}
@@ -186,6 +246,48 @@ func WithKeepalive(interval time.Duration) ServerOption {
 	}
 }
 
+// WithPing option enables sending ping messages with provided interval, closing the connection with
+// apollows.EventPongTimeout code if pong is not received within timeout, which is then reported to OnDisconnect.
+// Only applies to protocols supporting server-initiated ping, such as graphql-transport-ws.
+func WithPing(interval, timeout time.Duration) ServerOption {
+	return func(config *serverConfig) error {
+		config.pingInterval = interval
+		config.pongTimeout = timeout
+
+		return nil
+	}
+}
+
+// WithWriteTimeout option sets deadline for every websocket write, connection is closed once write times out and
+// ErrWriteTimeout is reported to OnDisconnect. Only applies to connections implementing DeadlineConn.
+func WithWriteTimeout(timeout time.Duration) ServerOption {
+	return func(config *serverConfig) error {
+		config.writeTimeout = timeout
+
+		return nil
+	}
+}
+
+// WithShutdownCloseCode option sets websocket close code sent to clients on Shutdown, such as
+// apollows.EventGoingAway (default) or apollows.EventServiceRestart
+func WithShutdownCloseCode(code apollows.MessageType) ServerOption {
+	return func(config *serverConfig) error {
+		config.shutdownCloseCode = code
+
+		return nil
+	}
+}
+
+// WithoutWebsocket option prevents requests from being upgraded to websocket connections, unless upgrader is
+// explicitly provided with WithUpgrader
+func WithoutWebsocket() ServerOption {
+	return func(config *serverConfig) error {
+		config.rejectWebsocket = true
+
+		return nil
+	}
+}
+
 // WithoutHTTPQueries option prevents HTTP queries from being handled, allowing only websocket queries
 func WithoutHTTPQueries() ServerOption {
 	return func(config *serverConfig) error {
@@ -195,10 +297,45 @@ func WithoutHTTPQueries() ServerOption {
 	}
 }
 
-// WithProtocol option sets protocol for this sever to use. May be specified multiple times.
-func WithProtocol(protocol apollows.Protocol) ServerOption {
+// WithoutSSE option prevents requests from being handled using graphql-sse protocol, which is otherwise selected for
+// requests accepting text/event-stream responses
+func WithoutSSE() ServerOption {
+	return func(config *serverConfig) error {
+		config.rejectSSE = true
+
+		return nil
+	}
+}
+
+// WithSSEPath option restricts graphql-sse protocol to requests with provided URL path, e.g. "/graphql/stream", other
+// requests are handled as plain ones. By default, graphql-sse is available on any path the server is mounted on for
+// requests accepting text/event-stream or carrying stream token header; stream reservations without Accept header
+// and stream token query parameter are only supported with WithSSEPath.
+func WithSSEPath(path string) ServerOption {
+	return func(config *serverConfig) error {
+		config.ssePath = path
+
+		return nil
+	}
+}
+
+// WithSSEReservations option sets duration graphql-sse single connection mode stream reservation is kept until
+// client connects to it (DefaultSSEReservationTimeout by default, or connect timeout if shorter), and maximum number of
+// reservations pending connection (DefaultMaxSSEReservations by default), further ones are rejected with 503
+func WithSSEReservations(timeout time.Duration, limit int) ServerOption {
 	return func(config *serverConfig) error {
-		config.subscriptionProtocols[protocol] = struct{}{}
+		config.sseReservationTimeout = timeout
+		config.maxSSEReservations = limit
+
+		return nil
+	}
+}
+
+// WithProtocol option sets protocol for this sever to use, either one of apollows.Protocol subprotocols or custom
+// Protocol implementation. May be specified multiple times.
+func WithProtocol(protocol Protocol) ServerOption {
+	return func(config *serverConfig) error {
+		config.subscriptionProtocols[protocol.String()] = protocol
 
 		return nil
 	}
@@ -214,6 +351,151 @@ func WithConnectTimeout(timeout time.Duration) ServerOption {
 	}
 }
 
+// WithBatchConcurrency option sets maximum number of operations of a single batched plain HTTP request to be executed
+// in parallel, by default operations are executed sequentially
+func WithBatchConcurrency(limit int) ServerOption {
+	return func(config *serverConfig) error {
+		config.batchConcurrency = limit
+
+		return nil
+	}
+}
+
+// WithMaxBatchSize option sets maximum number of operations of a single batched plain HTTP request,
+// DefaultMaxBatchSize by default; larger batches are rejected with 400
+func WithMaxBatchSize(limit int) ServerOption {
+	return func(config *serverConfig) error {
+		config.maxBatchSize = limit
+
+		return nil
+	}
+}
+
+// OperationLimitPolicy defines handling of operations exceeding WithMaxOperationsPerConnection limit
+type OperationLimitPolicy int
+
+const (
+	// OperationLimitReject terminates excess operation with ErrTooManyOperations error, keeping connection open
+	OperationLimitReject OperationLimitPolicy = iota
+
+	// OperationLimitClose closes the connection with apollows.EventTooManyOperations code
+	OperationLimitClose
+)
+
+// WithMaxOperationsPerConnection option limits number of concurrently running operations of a single websocket
+// connection, excess operations are handled according to provided policy.
+// Current number of running operations is available in callbacks with ContextOperationCount.
+func WithMaxOperationsPerConnection(limit int, policy OperationLimitPolicy) ServerOption {
+	return func(config *serverConfig) error {
+		config.maxOperations = limit
+		config.maxOperationsPolicy = policy
+
+		return nil
+	}
+}
+
+// WithOutgoingBuffer option sets number of messages buffered for sending per websocket connection (1 by default) and
+// number of results buffered per operation (unbuffered by default, at least 1 if overflow policy is set), allowing
+// operations to proceed while slow client is catching up
+func WithOutgoingBuffer(connection, subscription int) ServerOption {
+	return func(config *serverConfig) error {
+		config.connectionBuffer = connection
+		config.subscriptionBuffer = subscription
+
+		return nil
+	}
+}
+
+// WithOverflowPolicy option sets handling of operation results not fitting into operation buffer, see
+// WithOutgoingBuffer. By default, operation is suspended until buffer has space (OverflowBlock).
+// Each overflow is reported to OnOverflow callback.
+func WithOverflowPolicy(policy OverflowPolicy) ServerOption {
+	return func(config *serverConfig) error {
+		config.overflowPolicy = policy
+
+		return nil
+	}
+}
+
+// WithMaxDepth option limits nesting depth of operation field selections, with fragments expanded, operations
+// exceeding the limit are rejected with validation error
+func WithMaxDepth(limit int) ServerOption {
+	return func(config *serverConfig) error {
+		config.queryLimits.depth = limit
+
+		return nil
+	}
+}
+
+// WithMaxAliases option limits number of aliased fields of an operation, with fragments expanded, operations
+// exceeding the limit are rejected with validation error
+func WithMaxAliases(limit int) ServerOption {
+	return func(config *serverConfig) error {
+		config.queryLimits.aliases = limit
+
+		return nil
+	}
+}
+
+// WithMaxRootFields option limits number of top-level fields of an operation, operations exceeding the limit are
+// rejected with validation error
+func WithMaxRootFields(limit int) ServerOption {
+	return func(config *serverConfig) error {
+		config.queryLimits.rootFields = limit
+
+		return nil
+	}
+}
+
+// WithMaxFragmentSpreads option limits number of fragment spreads of an operation, with fragments expanded,
+// operations exceeding the limit are rejected with validation error
+func WithMaxFragmentSpreads(limit int) ServerOption {
+	return func(config *serverConfig) error {
+		config.queryLimits.fragmentSpreads = limit
+
+		return nil
+	}
+}
+
+// WithCostAnalysis option enables static operation cost analysis, cost is available with ContextCost, operations
+// exceeding CostAnalysis.MaxCost are rejected with validation error
+func WithCostAnalysis(analysis CostAnalysis) ServerOption {
+	return func(config *serverConfig) error {
+		config.costAnalysis = &analysis
+
+		return nil
+	}
+}
+
+// WithRateLimit option enables token bucket rate limiting of operations over every transport, each operation of a
+// batch taking its own token; operations are rejected with ErrRateLimited GraphQL error carrying retryAfter extension
+// (and Retry-After header for HTTP requests)
+func WithRateLimit(limit RateLimit) ServerOption {
+	return func(config *serverConfig) error {
+		if limit.Key == nil {
+			limit.Key = rateLimitKeyRemoteAddr
+		}
+
+		if limit.Store == nil {
+			limit.Store = NewMemoryRateLimitStore()
+		}
+
+		config.rateLimit = &limit
+
+		return nil
+	}
+}
+
+// WithPersistedQueries option enables automatic persisted queries, resolving and registering queries identified by
+// extensions.persistedQuery.sha256Hash with provided store
+func WithPersistedQueries(store PersistedQueryStore) ServerOption {
+	return func(config *serverConfig) error {
+		config.persistedQueries = store
+
+		return nil
+	}
+}
+
 // WithRootObject provides root object that will be used in root resolvers
 func WithRootObject(rootObject map[string]interface{}) ServerOption {
 	return func(config *serverConfig) error {
@@ -223,7 +505,8 @@ func WithRootObject(rootObject map[string]interface{}) ServerOption {
 	}
 }
 
-// WriteError helper function writing an error to http.ResponseWriter
+// WriteError helper function writing an error to http.ResponseWriter, GraphQL errors are written as JSON response
+// with status code chosen per GraphQL over HTTP spec, other errors are written as text with 400 code
 func WriteError(ctx context.Context, w http.ResponseWriter, err error) {
 	if err == nil || ContextHTTPResponseStarted(ctx) {
 		return
@@ -231,8 +514,15 @@ func WriteError(ctx context.Context, w http.ResponseWriter, err error) {
 
 	bs := []byte(err.Error())
 
+	if _, ok := err.(resultError); ok {
+		w.Header().Set("content-type", contextHTTPResponseMediaType(ctx)+"; charset=utf-8")
+	}
+
+	// avoids writing error again, such as by chained OnRequestDone handlers
+	RequestContext(ctx).Set(ContextKeyHTTPResponseStarted, true)
+
 	w.Header().Set("content-length", strconv.Itoa(len(bs)))
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(errorStatusCode(err))
 
 	_, _ = w.Write(bs)
 }
@@ -48,6 +48,14 @@ func TestWithoutHTTPQueries(t *testing.T) {
 	assert.Equal(t, true, c.rejectHTTPQueries)
 }
 
+func TestWithBatchConcurrency(t *testing.T) {
+	var c serverConfig
+
+	assert.NoError(t, WithBatchConcurrency(4)(&c))
+
+	assert.Equal(t, 4, c.batchConcurrency)
+}
+
 func TestWithRootObject(t *testing.T) {
 	var c serverConfig
 
@@ -152,6 +152,12 @@ const (
 	// EventCloseNormal standard websocket message type
 	EventCloseNormal MessageType = 1000
 
+	// EventGoingAway standard websocket message type, indicating server going down
+	EventGoingAway MessageType = 1001
+
+	// EventServiceRestart standard websocket message type, indicating server restarting
+	EventServiceRestart MessageType = 1012
+
 	// EventCloseError standard websocket message type
 	EventCloseError MessageType = 1006
 
@@ -161,6 +167,9 @@ const (
 	// EventUnauthorized indicated attempt to subscribe to an operation before receiving OperationConnectionAck
 	EventUnauthorized MessageType = 4401
 
+	// EventForbidden indicates connection initialization rejected, such as due to invalid credentials
+	EventForbidden MessageType = 4403
+
 	// EventInitializationTimeout indicates timeout occurring before client sending OperationConnectionInit
 	EventInitializationTimeout MessageType = 4408
 
@@ -170,14 +179,29 @@ const (
 	// EventSubscriberAlreadyExists indicates subscribed operation ID already being in use
 	// (not yet terminated by either OperationComplete or OperationError)
 	EventSubscriberAlreadyExists MessageType = 4409
+
+	// EventPongTimeout indicates client not responding to server-initiated OperationPing within configured timeout
+	EventPongTimeout MessageType = 4410
+
+	// EventTooManyOperations indicates client exceeding limit of concurrently running operations per connection
+	EventTooManyOperations MessageType = 4411
+
+	// EventSlowConsumer indicates client not reading operation results fast enough
+	EventSlowConsumer MessageType = 4412
 )
 
 var messageTypeDescriptions = map[MessageType]string{
 	EventCloseNormal:                   "Termination requested",
+	EventGoingAway:                     "Going away",
+	EventServiceRestart:                "Service restart",
 	EventInvalidMessage:                "Invalid message",
 	EventUnauthorized:                  "Unauthorized",
+	EventForbidden:                     "Forbidden",
 	EventInitializationTimeout:         "Connection initialisation timeout",
 	EventTooManyInitializationRequests: "Too many initialisation requests",
+	EventPongTimeout:                   "Pong timeout",
+	EventTooManyOperations:             "Too many operations",
+	EventSlowConsumer:                  "Slow consumer",
 }
 
 // EventMessageType implementation
@@ -0,0 +1,190 @@
+package apollows
+
+import (
+	"strings"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Action is a protocol-independent meaning of a message
+type Action int
+
+const (
+	// ActionUnknown indicates message not supported by the protocol
+	ActionUnknown Action = iota
+
+	// ActionConnectionInit client request to initialize the connection
+	ActionConnectionInit
+
+	// ActionConnectionAck server response to successful connection initialization
+	ActionConnectionAck
+
+	// ActionConnectionError server response to unsuccessful connection initialization or protocol error
+	ActionConnectionError
+
+	// ActionConnectionTerminate client request to gracefully close the connection
+	ActionConnectionTerminate
+
+	// ActionStart client request to start an operation
+	ActionStart
+
+	// ActionStop client request to stop previously started operation
+	ActionStop
+
+	// ActionData server response with operation result
+	ActionData
+
+	// ActionError server response terminating an operation with an error
+	ActionError
+
+	// ActionComplete server response indicating operation is complete
+	ActionComplete
+
+	// ActionPing request for ActionPong response
+	ActionPing
+
+	// ActionPong response to ActionPing
+	ActionPong
+
+	// ActionKeepalive server message sent periodically to maintain connection open
+	ActionKeepalive
+)
+
+// clientActions client message types accepted by both protocols
+var clientActions = map[Operation]Action{
+	OperationConnectionInit: ActionConnectionInit,
+	OperationStart:          ActionStart,
+	OperationSubscribe:      ActionStart,
+	OperationStop:           ActionStop,
+	OperationComplete:       ActionStop,
+	OperationTerminate:      ActionConnectionTerminate,
+	OperationPing:           ActionPing,
+	OperationPong:           ActionPong,
+}
+
+type protocolSpec struct {
+	server             map[Action]Operation
+	requireInit        bool
+	allowTerminate     bool
+	notifyStopped      bool
+	combineErrors      bool
+	invalidMessageCode bool
+}
+
+var protocolSpecs = map[Protocol]protocolSpec{
+	WebsocketSubprotocolGraphqlWS: {
+		server: map[Action]Operation{
+			ActionConnectionAck:   OperationConnectionAck,
+			ActionConnectionError: OperationConnectionError,
+			ActionData:            OperationData,
+			ActionError:           OperationError,
+			ActionComplete:        OperationComplete,
+			ActionPong:            OperationPong,
+			ActionKeepalive:       OperationKeepAlive,
+		},
+		allowTerminate: true,
+		notifyStopped:  true,
+		combineErrors:  true,
+	},
+	WebsocketSubprotocolGraphqlTransportWS: {
+		server: map[Action]Operation{
+			ActionConnectionAck: OperationConnectionAck,
+			ActionData:          OperationNext,
+			ActionError:         OperationError,
+			ActionComplete:      OperationComplete,
+			ActionPing:          OperationPing,
+			ActionPong:          OperationPong,
+			ActionKeepalive:     OperationPong,
+		},
+		requireInit:        true,
+		invalidMessageCode: true,
+	},
+}
+
+// ClientAction returns meaning of message type received from the client
+func (p Protocol) ClientAction(t Operation) Action {
+	return clientActions[t]
+}
+
+// ServerOperation returns message type to be sent by the server for provided action, or empty string if action is
+// not supported by the protocol
+func (p Protocol) ServerOperation(a Action) Operation {
+	return protocolSpecs[p].server[a]
+}
+
+// Authorize returns an error if client action is not allowed in current connection state
+func (p Protocol) Authorize(a Action, initialized bool) error {
+	spec := protocolSpecs[p]
+
+	switch a {
+	case ActionStart, ActionStop:
+		if !initialized && spec.requireInit {
+			return EventUnauthorized
+		}
+	case ActionConnectionTerminate:
+		if !spec.allowTerminate {
+			return EventUnauthorized
+		}
+	}
+
+	return nil
+}
+
+// NotifyStopped returns true if operations stopped by the client are still followed by results and complete message
+func (p Protocol) NotifyStopped() bool {
+	return protocolSpecs[p].notifyStopped
+}
+
+// FormatErrors returns error message payload for provided operation errors
+func (p Protocol) FormatErrors(errs []gqlerrors.FormattedError) interface{} {
+	if protocolSpecs[p].combineErrors {
+		return CombineErrors(errs)
+	}
+
+	return errs
+}
+
+// InvalidMessageError returns error to terminate the connection with when client message can't be decoded
+func (p Protocol) InvalidMessageError(err error) error {
+	if protocolSpecs[p].invalidMessageCode {
+		return WrapError(err, EventInvalidMessage)
+	}
+
+	return err
+}
+
+// CloseCode returns websocket close code for provided error
+func (p Protocol) CloseCode(err Error) int {
+	return int(err.EventMessageType())
+}
+
+// CombineErrors combines multiple errors into single one, keeping original errors in extensions
+func CombineErrors(errs []gqlerrors.FormattedError) gqlerrors.FormattedError {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+
+	errmsg := "preparing operation"
+
+	var errmsgs []string
+
+	for _, err := range errs {
+		errmsgs = append(errmsgs, err.Error())
+	}
+
+	if len(errmsgs) > 0 {
+		errmsg += ": " + strings.Join(errmsgs, "; ")
+	}
+
+	rooterr := gqlerrors.NewFormattedError(errmsg)
+
+	if len(errs) > 0 {
+		if (rooterr.Extensions) == nil {
+			rooterr.Extensions = make(map[string]interface{})
+		}
+
+		rooterr.Extensions["errors"] = errs
+	}
+
+	return rooterr
+}
@@ -0,0 +1,60 @@
+package apollows
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolServerOperation(t *testing.T) {
+	assert.Equal(t, OperationData, WebsocketSubprotocolGraphqlWS.ServerOperation(ActionData))
+	assert.Equal(t, OperationNext, WebsocketSubprotocolGraphqlTransportWS.ServerOperation(ActionData))
+	assert.Equal(t, OperationKeepAlive, WebsocketSubprotocolGraphqlWS.ServerOperation(ActionKeepalive))
+	assert.Equal(t, OperationPong, WebsocketSubprotocolGraphqlTransportWS.ServerOperation(ActionKeepalive))
+	assert.Equal(t, OperationConnectionError, WebsocketSubprotocolGraphqlWS.ServerOperation(ActionConnectionError))
+	assert.Equal(t, Operation(""), WebsocketSubprotocolGraphqlTransportWS.ServerOperation(ActionConnectionError))
+	assert.Equal(t, Operation(""), Protocol("foo").ServerOperation(ActionData))
+}
+
+func TestProtocolClientAction(t *testing.T) {
+	for _, p := range []Protocol{WebsocketSubprotocolGraphqlWS, WebsocketSubprotocolGraphqlTransportWS} {
+		assert.Equal(t, ActionStart, p.ClientAction(OperationStart))
+		assert.Equal(t, ActionStart, p.ClientAction(OperationSubscribe))
+		assert.Equal(t, ActionStop, p.ClientAction(OperationStop))
+		assert.Equal(t, ActionStop, p.ClientAction(OperationComplete))
+		assert.Equal(t, ActionUnknown, p.ClientAction("foo"))
+	}
+}
+
+func TestProtocolAuthorize(t *testing.T) {
+	assert.NoError(t, WebsocketSubprotocolGraphqlWS.Authorize(ActionStart, false))
+	assert.NoError(t, WebsocketSubprotocolGraphqlWS.Authorize(ActionConnectionTerminate, true))
+	assert.Equal(t, EventUnauthorized, WebsocketSubprotocolGraphqlTransportWS.Authorize(ActionStart, false))
+	assert.NoError(t, WebsocketSubprotocolGraphqlTransportWS.Authorize(ActionStart, true))
+	assert.Equal(t, EventUnauthorized, WebsocketSubprotocolGraphqlTransportWS.Authorize(ActionConnectionTerminate, true))
+}
+
+func TestProtocolErrors(t *testing.T) {
+	errs := []gqlerrors.FormattedError{
+		gqlerrors.NewFormattedError("foo"),
+		gqlerrors.NewFormattedError("bar"),
+	}
+
+	assert.Equal(t, errs, WebsocketSubprotocolGraphqlTransportWS.FormatErrors(errs))
+
+	combined, ok := WebsocketSubprotocolGraphqlWS.FormatErrors(errs).(gqlerrors.FormattedError)
+
+	assert.True(t, ok)
+	assert.Equal(t, "preparing operation: foo; bar", combined.Message)
+	assert.Equal(t, errs[0], CombineErrors(errs[:1]))
+
+	err := errors.New("foo")
+
+	assert.Equal(t, err, WebsocketSubprotocolGraphqlWS.InvalidMessageError(err))
+
+	gtws := WebsocketSubprotocolGraphqlTransportWS
+
+	assert.Equal(t, int(EventInvalidMessage), gtws.CloseCode(gtws.InvalidMessageError(err).(Error)))
+}
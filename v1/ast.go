@@ -197,6 +197,16 @@ func (server *serverImpl) parseAST(
 		return
 	}
 
+	// shape limits are checked before validation, which is itself expensive on deeply nested or repetitive documents
+	errs := server.checkQueryLimits(astdoc, payload.OperationName)
+	if len(errs) > 0 {
+		result = &graphql.Result{
+			Errors: errs,
+		}
+
+		return
+	}
+
 	errs, validationFinishFn := server.handleExtensionsValidationDidStart(&params)
 
 	validationResult := graphql.ValidateDocument(&params.Schema, astdoc, nil)
@@ -211,6 +221,15 @@ func (server *serverImpl) parseAST(
 		return
 	}
 
+	errs = server.checkCost(opctx, astdoc, &params)
+	if len(errs) > 0 {
+		result = &graphql.Result{
+			Errors: errs,
+		}
+
+		return
+	}
+
 	for _, definition := range astdoc.Definitions {
 		op, ok := definition.(*ast.OperationDefinition)
 		if !ok {
@@ -0,0 +1,273 @@
+// Package auth provides JWT bearer token authentication of plain requests and websocket connections, verifying tokens
+// with keys of a local JSON Web Key Set
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+)
+
+// DefaultInitKey is connection_init payload key the token is read from by default
+const DefaultInitKey = "Authorization"
+
+// ErrMissingToken returned when request has no bearer token
+var ErrMissingToken = errors.New("missing bearer token")
+
+// Authenticator verifies bearer tokens, storing their claims in request context, see ContextClaims
+type Authenticator interface {
+	// Callbacks returns callbacks authenticating requests and websocket connections in OnConnect, calling provided
+	// ones after successful authentication
+	Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks
+
+	// Verify verifies token signature and claims, returning the claims
+	Verify(token string) (Claims, error)
+}
+
+type authConfig struct {
+	initKey  string
+	issuer   string
+	audience string
+	leeway   time.Duration
+	optional bool
+	now      func() time.Time
+}
+
+// Option to configure Authenticator
+type Option func(config *authConfig) error
+
+// WithInitKey option sets websocket connection_init payload key the token is read from, DefaultInitKey by default.
+// Value could be either a token or a token with "Bearer " prefix.
+func WithInitKey(key string) Option {
+	return func(config *authConfig) error {
+		config.initKey = key
+
+		return nil
+	}
+}
+
+// WithIssuer option requires tokens to have provided "iss" claim
+func WithIssuer(issuer string) Option {
+	return func(config *authConfig) error {
+		config.issuer = issuer
+
+		return nil
+	}
+}
+
+// WithAudience option requires tokens to have provided value in "aud" claim
+func WithAudience(audience string) Option {
+	return func(config *authConfig) error {
+		config.audience = audience
+
+		return nil
+	}
+}
+
+// WithLeeway option sets allowed clock skew when checking "exp" and "nbf" claims
+func WithLeeway(leeway time.Duration) Option {
+	return func(config *authConfig) error {
+		config.leeway = leeway
+
+		return nil
+	}
+}
+
+// WithOptional option allows requests without a token, leaving them without claims; invalid tokens are still rejected
+func WithOptional() Option {
+	return func(config *authConfig) error {
+		config.optional = true
+
+		return nil
+	}
+}
+
+type contextKeyClaimsT struct{}
+
+var contextKeyClaims = contextKeyClaimsT{}
+
+// ContextClaims returns verified token claims of the request, or nil if request is not authenticated
+func ContextClaims(ctx context.Context) Claims {
+	claims, _ := ctx.Value(contextKeyClaims).(Claims)
+
+	return claims
+}
+
+type authenticator struct {
+	keys KeySet
+	authConfig
+}
+
+// New returns new Authenticator verifying tokens with provided keys
+func New(keys KeySet, options ...Option) (Authenticator, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	config := authConfig{
+		initKey: DefaultInitKey,
+		now:     time.Now,
+	}
+
+	for _, o := range options {
+		err := o(&config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &authenticator{
+		keys:       keys,
+		authConfig: config,
+	}, nil
+}
+
+func (a *authenticator) Verify(token string) (Claims, error) {
+	payload, err := a.keys.verifySignature(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := parseClaims(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+
+	if exp := claims.ExpiresAt(); !exp.IsZero() && !now.Before(exp.Add(a.leeway)) {
+		return nil, ErrTokenExpired
+	}
+
+	if nbf := claims.NotBefore(); !nbf.IsZero() && now.Add(a.leeway).Before(nbf) {
+		return nil, ErrTokenNotYetValid
+	}
+
+	if a.issuer != "" && claims.Issuer() != a.issuer {
+		return nil, ErrInvalidIssuer
+	}
+
+	if a.audience != "" && !contains(claims.Audience(), a.audience) {
+		return nil, ErrInvalidAudience
+	}
+
+	return claims, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cutBearer returns value without "Bearer " prefix, reporting whether it was present
+func cutBearer(value string) (string, bool) {
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:]), true
+	}
+
+	return value, false
+}
+
+// token returns bearer token from connection_init payload of websocket connections, falling back to Authorization
+// header of the request
+func (a *authenticator) token(reqctx mutable.Context, init apollows.PayloadInit) string {
+	if s, ok := init[a.initKey].(string); ok && s != "" {
+		s, _ = cutBearer(s)
+
+		return s
+	}
+
+	if r := wsgraphql.ContextHTTPRequest(reqctx); r != nil {
+		if s, ok := cutBearer(r.Header.Get("Authorization")); ok {
+			return s
+		}
+	}
+
+	return ""
+}
+
+// authenticate verifies request token, returning error to be reported to the client
+func (a *authenticator) authenticate(reqctx mutable.Context, init apollows.PayloadInit) error {
+	websocket := wsgraphql.ContextWebsocketConnection(reqctx) != nil
+
+	token := a.token(reqctx, init)
+	if token == "" {
+		if a.optional {
+			return nil
+		}
+
+		return a.reject(reqctx, websocket, ErrMissingToken)
+	}
+
+	claims, err := a.Verify(token)
+	if err != nil {
+		return a.reject(reqctx, websocket, err)
+	}
+
+	reqctx.Set(contextKeyClaims, claims)
+
+	if exp := claims.ExpiresAt(); websocket && !exp.IsZero() {
+		go a.expire(reqctx, exp.Add(a.leeway))
+	}
+
+	return nil
+}
+
+// reject returns error closing websocket connection with 4403, or responding to plain requests with 401
+func (a *authenticator) reject(reqctx mutable.Context, websocket bool, err error) error {
+	if websocket {
+		return apollows.WrapError(err, apollows.EventForbidden)
+	}
+
+	if w := wsgraphql.ContextHTTPResponseWriter(reqctx); w != nil {
+		challenge := `Bearer error="invalid_token"`
+
+		if errors.Is(err, ErrMissingToken) {
+			challenge = "Bearer"
+		}
+
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+
+	return apollows.WrapError(err, apollows.EventUnauthorized)
+}
+
+// expire closes websocket connection with 4401 once token expires
+func (a *authenticator) expire(reqctx mutable.Context, exp time.Time) {
+	timer := time.NewTimer(exp.Sub(a.now()))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		wsgraphql.CloseContextConnection(reqctx, apollows.WrapError(ErrTokenExpired, apollows.EventUnauthorized))
+	case <-reqctx.Done():
+	}
+}
+
+func (a *authenticator) Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks {
+	res := next
+
+	res.OnConnect = func(reqctx mutable.Context, init apollows.PayloadInit) error {
+		if err := a.authenticate(reqctx, init); err != nil {
+			return err
+		}
+
+		if next.OnConnect != nil {
+			return next.OnConnect(reqctx, init)
+		}
+
+		return nil
+	}
+
+	return res
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewServer(t *testing.T, a Authenticator) *httptest.Server {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"me": &graphql.Field{
+					Type: graphql.String,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return ContextClaims(p.Context).Subject(), nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	server, err := wsgraphql.NewServer(schema, wsgraphql.WithCallbacks(a.Callbacks(wsgraphql.Callbacks{})))
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func TestAuthenticatorPlain(t *testing.T) {
+	tk := testNewKeys(t)
+
+	keys, err := LoadJWKS(tk.jwks(t))
+	assert.NoError(t, err)
+
+	a, err := New(keys)
+	assert.NoError(t, err)
+
+	srv := testNewServer(t, a)
+
+	defer srv.Close()
+
+	for name, tc := range map[string]struct {
+		authorization string
+		status        int
+		challenge     string
+		body          string
+	}{
+		"missing": {
+			status:    http.StatusUnauthorized,
+			challenge: "Bearer",
+		},
+		"invalid": {
+			authorization: "Bearer " + tk.sign(t, "HS256", "hmac", map[string]interface{}{"exp": 1}),
+			status:        http.StatusUnauthorized,
+			challenge:     `Bearer error="invalid_token"`,
+		},
+		"valid": {
+			authorization: "Bearer " + tk.sign(t, "RS256", "rsa", map[string]interface{}{"sub": "user"}),
+			status:        http.StatusOK,
+			body:          `{"data":{"me":"user"}}`,
+		},
+	} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"query":"query { me }"}`))
+		assert.NoError(t, err)
+
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+
+		assert.Equal(t, tc.status, resp.StatusCode, name)
+		assert.Equal(t, tc.challenge, resp.Header.Get("WWW-Authenticate"), name)
+
+		if tc.body != "" {
+			bs, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+
+			assert.JSONEq(t, tc.body, string(bs), name)
+		}
+
+		assert.NoError(t, resp.Body.Close())
+	}
+}
+
+func testDial(t *testing.T, srv *httptest.Server, init apollows.PayloadInit) *websocket.Conn {
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+		Payload: apollows.Data{
+			Value: init,
+		},
+	}))
+
+	return conn
+}
+
+func testCloseCode(t *testing.T, conn *websocket.Conn) int {
+	var (
+		msg apollows.Message
+		err error
+	)
+
+	for err == nil {
+		err = conn.ReadJSON(&msg)
+	}
+
+	var cerr *websocket.CloseError
+
+	assert.True(t, errors.As(err, &cerr), err)
+
+	return cerr.Code
+}
+
+func TestAuthenticatorWebsocket(t *testing.T) {
+	tk := testNewKeys(t)
+
+	keys, err := LoadJWKS(tk.jwks(t))
+	assert.NoError(t, err)
+
+	exp := time.Now().Add(time.Minute).Truncate(time.Second)
+
+	a, err := New(keys, WithInitKey("authToken"))
+	assert.NoError(t, err)
+
+	// clock is shifted for the token to expire shortly after connection
+	offset := time.Until(exp) - time.Millisecond*300
+
+	a.(*authenticator).now = func() time.Time {
+		return time.Now().Add(offset)
+	}
+
+	srv := testNewServer(t, a)
+
+	defer srv.Close()
+
+	conn := testDial(t, srv, apollows.PayloadInit{
+		"authToken": tk.sign(t, "ES256", "ec", map[string]interface{}{"sub": "user", "exp": exp.Unix() - 120}),
+	})
+
+	assert.EqualValues(t, apollows.EventForbidden, testCloseCode(t, conn))
+	assert.NoError(t, conn.Close())
+
+	conn = testDial(t, srv, apollows.PayloadInit{
+		"authToken": "Bearer " + tk.sign(t, "ES256", "ec", map[string]interface{}{"sub": "user", "exp": exp.Unix()}),
+	})
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { me }`,
+			},
+		},
+	}))
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+	assert.JSONEq(t, `{"data":{"me":"user"}}`, string(msg.Payload.RawMessage))
+
+	assert.EqualValues(t, apollows.EventUnauthorized, testCloseCode(t, conn))
+	assert.NoError(t, conn.Close())
+}
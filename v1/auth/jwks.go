@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// ErrNoKeys returned when key set contains no usable signature verification keys
+var ErrNoKeys = errors.New("no usable keys in key set")
+
+// Key is a signature verification key of a key set
+type Key struct {
+	// ID is the key identifier, matched against "kid" token header
+	ID string
+	// Algorithm the key is restricted to, any algorithm of matching key type if empty
+	Algorithm string
+	// Public is []byte for HMAC keys, *rsa.PublicKey or *ecdsa.PublicKey otherwise
+	Public interface{}
+}
+
+// KeySet is a set of keys tokens are verified with
+type KeySet []Key
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// LoadJWKS reads JSON Web Key Set (RFC 7517) from a local file
+func LoadJWKS(path string) (KeySet, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseJWKS(bs)
+}
+
+// ParseJWKS parses JSON Web Key Set (RFC 7517) with "oct", "RSA" and "EC" keys, skipping keys of other types and
+// keys not intended for signatures. Symmetric keys shorter than hash output and EC points not on curve are rejected
+func ParseJWKS(data []byte) (KeySet, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err := json.Unmarshal(data, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys KeySet
+
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		public, err := k.public()
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i, err)
+		}
+
+		if public == nil {
+			continue
+		}
+
+		keys = append(keys, Key{
+			ID:        k.Kid,
+			Algorithm: k.Alg,
+			Public:    public,
+		})
+	}
+
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	return keys, nil
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// public returns verification key of the jwk, or nil if key type is not supported
+func (k jwk) public() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		return k.symmetric()
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeSegment(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		return k.ecdsa()
+	}
+
+	return nil, nil
+}
+
+// symmetric returns HMAC key, at least as long as hash output of its algorithm (or of HS256 if unrestricted), as
+// required by RFC 7518
+func (k jwk) symmetric() (interface{}, error) {
+	key, err := decodeSegment(k.K)
+	if err != nil {
+		return nil, err
+	}
+
+	size := crypto.SHA256.Size()
+
+	if alg, ok := algorithms[k.Alg]; ok && alg.kty == "oct" {
+		size = alg.hash.Size()
+	}
+
+	if len(key) < size {
+		return nil, fmt.Errorf("symmetric key of %d bytes is shorter than %d bytes", len(key), size)
+	}
+
+	return key, nil
+}
+
+func (k jwk) ecdsa() (interface{}, error) {
+	var curve elliptic.Curve
+
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeSegment(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := decodeSegment(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("EC point is not on curve")
+	}
+
+	return key, nil
+}
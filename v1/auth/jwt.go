@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	// hash implementations used by supported algorithms
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// Token verification errors
+var (
+	ErrMalformedToken       = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature     = errors.New("invalid token signature")
+	ErrTokenExpired         = errors.New("token expired")
+	ErrTokenNotYetValid     = errors.New("token not yet valid")
+	ErrInvalidIssuer        = errors.New("invalid token issuer")
+	ErrInvalidAudience      = errors.New("invalid token audience")
+)
+
+// Claims are verified token claims
+type Claims map[string]interface{}
+
+// Subject returns "sub" claim
+func (c Claims) Subject() string {
+	s, _ := c["sub"].(string)
+
+	return s
+}
+
+// Issuer returns "iss" claim
+func (c Claims) Issuer() string {
+	s, _ := c["iss"].(string)
+
+	return s
+}
+
+// Audience returns "aud" claim, which could be either a string or an array of strings
+func (c Claims) Audience() []string {
+	switch v := c["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				res = append(res, s)
+			}
+		}
+
+		return res
+	}
+
+	return nil
+}
+
+// ExpiresAt returns "exp" claim, zero time if token does not expire
+func (c Claims) ExpiresAt() time.Time {
+	return c.time("exp")
+}
+
+// NotBefore returns "nbf" claim, zero time if not set
+func (c Claims) NotBefore() time.Time {
+	return c.time("nbf")
+}
+
+func (c Claims) time(key string) time.Time {
+	v, ok := c[key].(json.Number)
+	if !ok {
+		return time.Time{}
+	}
+
+	f, err := v.Float64()
+	if err != nil {
+		return time.Time{}
+	}
+
+	sec := int64(f)
+
+	return time.Unix(sec, int64((f-float64(sec))*float64(time.Second)))
+}
+
+type algorithm struct {
+	kty  string
+	crv  string // curve EC algorithm is bound to
+	hash crypto.Hash
+	pss  bool
+}
+
+var algorithms = map[string]algorithm{
+	"HS256": {kty: "oct", hash: crypto.SHA256},
+	"HS384": {kty: "oct", hash: crypto.SHA384},
+	"HS512": {kty: "oct", hash: crypto.SHA512},
+	"RS256": {kty: "RSA", hash: crypto.SHA256},
+	"RS384": {kty: "RSA", hash: crypto.SHA384},
+	"RS512": {kty: "RSA", hash: crypto.SHA512},
+	"PS256": {kty: "RSA", hash: crypto.SHA256, pss: true},
+	"PS384": {kty: "RSA", hash: crypto.SHA384, pss: true},
+	"PS512": {kty: "RSA", hash: crypto.SHA512, pss: true},
+	"ES256": {kty: "EC", crv: "P-256", hash: crypto.SHA256},
+	"ES384": {kty: "EC", crv: "P-384", hash: crypto.SHA384},
+	"ES512": {kty: "EC", crv: "P-521", hash: crypto.SHA512},
+}
+
+func keyType(public interface{}) string {
+	switch public.(type) {
+	case []byte:
+		return "oct"
+	case *rsa.PublicKey:
+		return "RSA"
+	case *ecdsa.PublicKey:
+		return "EC"
+	}
+
+	return ""
+}
+
+func (alg algorithm) verify(public interface{}, signed, signature []byte) bool {
+	h := alg.hash.New()
+	_, _ = h.Write(signed)
+
+	switch key := public.(type) {
+	case []byte:
+		// keys of unrestricted algorithm are only verified to fit HS256 when parsed
+		if len(key) < alg.hash.Size() {
+			return false
+		}
+
+		mac := hmac.New(alg.hash.New, key)
+		_, _ = mac.Write(signed)
+
+		return hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PublicKey:
+		if alg.pss {
+			return rsa.VerifyPSS(key, alg.hash, h.Sum(nil), signature, nil) == nil
+		}
+
+		return rsa.VerifyPKCS1v15(key, alg.hash, h.Sum(nil), signature) == nil
+	case *ecdsa.PublicKey:
+		if key.Curve.Params().Name != alg.crv {
+			return false
+		}
+
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+
+		return ecdsa.Verify(key, h.Sum(nil), r, s)
+	}
+
+	return false
+}
+
+// verifySignature checks compact serialized token signature against matching keys, returning its decoded payload
+func (keys KeySet) verifySignature(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+
+	bs, err := decodeSegment(parts[0])
+	if err != nil || json.Unmarshal(bs, &header) != nil {
+		return nil, ErrMalformedToken
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	alg, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+
+	for _, key := range keys {
+		if header.Kid != "" && key.ID != header.Kid ||
+			key.Algorithm != "" && key.Algorithm != header.Alg ||
+			keyType(key.Public) != alg.kty {
+			continue
+		}
+
+		if alg.verify(key.Public, signed, signature) {
+			payload, err := decodeSegment(parts[1])
+			if err != nil {
+				return nil, ErrMalformedToken
+			}
+
+			return payload, nil
+		}
+	}
+
+	return nil, ErrInvalidSignature
+}
+
+// parseClaims decodes token payload, keeping numeric claims as json.Number
+func parseClaims(payload []byte) (Claims, error) {
+	var claims Claims
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	if err := dec.Decode(&claims); err != nil || claims == nil {
+		return nil, ErrMalformedToken
+	}
+
+	return claims, nil
+}
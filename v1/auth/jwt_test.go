@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testKeys struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+}
+
+func testNewKeys(t *testing.T) *testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	return &testKeys{
+		secret: []byte(strings.Repeat("0123456789abcdef", 4)),
+		rsa:    rsaKey,
+		ec:     ecKey,
+	}
+}
+
+func b64(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+func padded(v *big.Int, size int) []byte {
+	bs := make([]byte, size)
+
+	return v.FillBytes(bs)
+}
+
+// jwks writes key set to a temporary file, returning its path
+func (keys *testKeys) jwks(t *testing.T) string {
+	bs, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "oct", "kid": "hmac", "k": b64(keys.secret)},
+			{
+				"kty": "RSA",
+				"kid": "rsa",
+				"n":   b64(keys.rsa.N.Bytes()),
+				"e":   b64(big.NewInt(int64(keys.rsa.E)).Bytes()),
+			},
+			{
+				"kty": "EC",
+				"kid": "ec",
+				"alg": "ES256",
+				"crv": "P-256",
+				"x":   b64(padded(keys.ec.X, 32)),
+				"y":   b64(padded(keys.ec.Y, 32)),
+			},
+			{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+			{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": "AA"},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	assert.NoError(t, os.WriteFile(path, bs, 0o600))
+
+	return path
+}
+
+func (keys *testKeys) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	assert.NoError(t, err)
+
+	payload, err := json.Marshal(claims)
+	assert.NoError(t, err)
+
+	signed := b64(header) + "." + b64(payload)
+
+	a := algorithms[alg]
+
+	h := a.hash.New()
+	_, _ = h.Write([]byte(signed))
+
+	var signature []byte
+
+	switch a.kty {
+	case "oct":
+		mac := hmac.New(a.hash.New, keys.secret)
+		_, _ = mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RSA":
+		if a.pss {
+			signature, err = rsa.SignPSS(rand.Reader, keys.rsa, a.hash, h.Sum(nil), nil)
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, keys.rsa, a.hash, h.Sum(nil))
+		}
+
+		assert.NoError(t, err)
+	case "EC":
+		r, s, err := ecdsa.Sign(rand.Reader, keys.ec, h.Sum(nil))
+		assert.NoError(t, err)
+
+		signature = append(padded(r, 32), padded(s, 32)...)
+	}
+
+	return signed + "." + b64(signature)
+}
+
+func TestLoadJWKS(t *testing.T) {
+	keys, err := LoadJWKS(testNewKeys(t).jwks(t))
+
+	assert.NoError(t, err)
+	assert.Len(t, keys, 3)
+	assert.IsType(t, []byte{}, keys[0].Public)
+	assert.IsType(t, &rsa.PublicKey{}, keys[1].Public)
+	assert.IsType(t, &ecdsa.PublicKey{}, keys[2].Public)
+	assert.Equal(t, "ES256", keys[2].Algorithm)
+
+	_, err = ParseJWKS([]byte(`{"keys":[]}`))
+
+	assert.ErrorIs(t, err, ErrNoKeys)
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"EC","crv":"P-192","x":"AA","y":"AA"}]}`))
+
+	assert.Error(t, err)
+
+	for _, key := range []string{
+		`{"kty":"oct","k":""}`,
+		`{"kty":"oct","k":"` + b64(make([]byte, 31)) + `"}`,
+		`{"kty":"oct","alg":"HS512","k":"` + b64(make([]byte, 32)) + `"}`,
+		`{"kty":"EC","crv":"P-256","x":"` + b64(make([]byte, 32)) + `","y":"` + b64(make([]byte, 32)) + `"}`,
+	} {
+		_, err = ParseJWKS([]byte(`{"keys":[` + key + `]}`))
+
+		assert.Error(t, err, key)
+	}
+
+	short := make([]byte, 32)
+	mac := hmac.New(algorithms["HS512"].hash.New, short)
+
+	_, _ = mac.Write([]byte("signed"))
+
+	assert.False(t, algorithms["HS512"].verify(short, []byte("signed"), mac.Sum(nil)))
+
+	_, err = LoadJWKS(filepath.Join(t.TempDir(), "missing.json"))
+
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	tk := testNewKeys(t)
+
+	keys, err := LoadJWKS(tk.jwks(t))
+	assert.NoError(t, err)
+
+	now := time.Now()
+
+	a, err := New(keys, WithIssuer("issuer"), WithAudience("api"), WithLeeway(time.Second))
+	assert.NoError(t, err)
+
+	a.(*authenticator).now = func() time.Time {
+		return now
+	}
+
+	valid := map[string]interface{}{
+		"sub": "user",
+		"iss": "issuer",
+		"aud": []string{"other", "api"},
+		"exp": now.Add(time.Minute).Unix(),
+		"nbf": now.Unix(),
+	}
+
+	for _, alg := range []string{"HS256", "HS384", "HS512", "RS256", "RS384", "RS512", "PS256", "PS384", "PS512"} {
+		kid := "hmac"
+		if alg[0] != 'H' {
+			kid = "rsa"
+		}
+
+		claims, err := a.Verify(tk.sign(t, alg, kid, valid))
+
+		assert.NoError(t, err, alg)
+		assert.Equal(t, "user", claims.Subject())
+		assert.Equal(t, []string{"other", "api"}, claims.Audience())
+		assert.Equal(t, now.Add(time.Minute).Unix(), claims.ExpiresAt().Unix())
+
+		// key could be selected without kid header
+		_, err = a.Verify(tk.sign(t, alg, "", valid))
+
+		assert.NoError(t, err, alg)
+	}
+
+	_, err = a.Verify(tk.sign(t, "ES256", "ec", valid))
+
+	assert.NoError(t, err)
+
+	hs := func(claims map[string]interface{}) string {
+		return tk.sign(t, "HS256", "hmac", claims)
+	}
+
+	parts := strings.Split(hs(valid), ".")
+	tampered := parts[0] + "." + b64([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+
+	for name, tc := range map[string]struct {
+		token string
+		err   error
+	}{
+		"malformed": {token: "abc.def", err: ErrMalformedToken},
+		"none":      {token: b64([]byte(`{"alg":"none"}`)) + "." + b64([]byte(`{}`)) + ".", err: ErrUnsupportedAlgorithm},
+		"wrong kid": {token: tk.sign(t, "RS256", "hmac", valid), err: ErrInvalidSignature},
+		"key alg":   {token: tk.sign(t, "ES384", "ec", valid), err: ErrInvalidSignature},
+		"tampered":  {token: tampered, err: ErrInvalidSignature},
+		"expired":   {token: hs(with(valid, "exp", now.Add(-time.Second).Unix())), err: ErrTokenExpired},
+		"not yet":   {token: hs(with(valid, "nbf", now.Add(time.Minute).Unix())), err: ErrTokenNotYetValid},
+		"issuer":    {token: hs(with(valid, "iss", "other")), err: ErrInvalidIssuer},
+		"audience":  {token: hs(with(valid, "aud", "other")), err: ErrInvalidAudience},
+		"no aud":    {token: hs(with(valid, "aud", nil)), err: ErrInvalidAudience},
+	} {
+		_, err := a.Verify(tc.token)
+
+		assert.ErrorIs(t, err, tc.err, name)
+	}
+
+	// expiry within leeway is accepted
+	_, err = a.Verify(hs(with(valid, "exp", now.Unix())))
+
+	assert.NoError(t, err)
+}
+
+func TestVerifyCurve(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+
+	// unrestricted key is only used with algorithm of its curve
+	keys := KeySet{{ID: "ec", Public: &ecKey.PublicKey}}
+
+	sign := func(alg string) string {
+		header, err := json.Marshal(map[string]string{"alg": alg, "kid": "ec"})
+		assert.NoError(t, err)
+
+		signed := b64(header) + "." + b64([]byte(`{"sub":"user"}`))
+
+		h := algorithms[alg].hash.New()
+		_, _ = h.Write([]byte(signed))
+
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, h.Sum(nil))
+		assert.NoError(t, err)
+
+		return signed + "." + b64(append(padded(r, 48), padded(s, 48)...))
+	}
+
+	_, err = keys.verifySignature(sign("ES384"))
+
+	assert.NoError(t, err)
+
+	for _, alg := range []string{"ES256", "ES512"} {
+		_, err = keys.verifySignature(sign(alg))
+
+		assert.ErrorIs(t, err, ErrInvalidSignature, alg)
+	}
+}
+
+func with(claims map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(claims))
+
+	for k, v := range claims {
+		res[k] = v
+	}
+
+	if value == nil {
+		delete(res, key)
+	} else {
+		res[key] = value
+	}
+
+	return res
+}
+
+func TestNewNoKeys(t *testing.T) {
+	_, err := New(nil)
+
+	assert.ErrorIs(t, err, ErrNoKeys)
+}
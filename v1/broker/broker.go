@@ -0,0 +1,417 @@
+// Package broker provides in-process publish/subscribe of typed values over named topics, with per-subscriber
+// buffering, suitable for feeding subscription fields
+package broker
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// DefaultBuffer is number of values buffered for each subscriber by default
+const DefaultBuffer = 16
+
+var (
+	// ErrClosed returned when publishing or subscribing to a closed topic or broker
+	ErrClosed = errors.New("topic closed")
+
+	// ErrTopicType returned when topic exists with a different value type
+	ErrTopicType = errors.New("topic exists with different value type")
+)
+
+// OverflowPolicy defines handling of published values not fitting into buffer of a slow subscriber
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest buffered value of the subscriber
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDropNewest discards the published value for the subscriber
+	OverflowDropNewest
+
+	// OverflowBlock suspends publishing until subscriber buffer has space, or subscriber is removed. Publishing to
+	// the same topic is serialized, so a slow subscriber delays delivery of subsequent values to all subscribers,
+	// though subscribing, unsubscribing and closing the topic are not affected
+	OverflowBlock
+)
+
+type config struct {
+	buffer int
+	policy OverflowPolicy
+}
+
+// Option to configure Broker or Topic
+type Option func(config *config) error
+
+// WithBuffer option sets number of values buffered for each subscriber, DefaultBuffer by default
+func WithBuffer(buffer int) Option {
+	return func(config *config) error {
+		if buffer < 0 {
+			return errors.New("negative buffer")
+		}
+
+		config.buffer = buffer
+
+		return nil
+	}
+}
+
+// WithOverflowPolicy option sets handling of values not fitting into subscriber buffer, OverflowDropOldest by default
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(config *config) error {
+		config.policy = policy
+
+		return nil
+	}
+}
+
+func newConfig(options []Option) (config, error) {
+	c := config{
+		buffer: DefaultBuffer,
+		policy: OverflowDropOldest,
+	}
+
+	for _, o := range options {
+		err := o(&c)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	return c, nil
+}
+
+// Topic delivers published values to its subscribers
+type Topic[T any] interface {
+	// Name returns topic name, empty for topics created outside of Broker
+	Name() string
+
+	// Publish delivers value to all current subscribers. Returns ErrClosed if topic is closed, or context error if
+	// publishing was suspended by OverflowBlock policy and provided context is done; in that case the value is not
+	// delivered to subscribers remaining at that point, while ones it was already delivered to keep it.
+	Publish(ctx context.Context, value T) error
+
+	// Subscribe returns channel receiving published values; subscriber is removed and channel is closed once
+	// provided context, such as operation mutable.Context, is done or topic is closed
+	Subscribe(ctx context.Context) (<-chan T, error)
+
+	// Subscribers returns number of current subscribers
+	Subscribers() int
+
+	// Close closes channels of all subscribers, rejecting further publishing and subscriptions
+	Close()
+}
+
+type subscriber[T any] struct {
+	ch   chan T
+	ctx  context.Context
+	done chan struct{}
+	once sync.Once
+	m    sync.Mutex
+}
+
+// close closes subscriber channel once no value is being sent to it, blocked sending is released first
+func (sub *subscriber[T]) close() {
+	sub.once.Do(func() {
+		close(sub.done)
+
+		sub.m.Lock()
+		defer sub.m.Unlock()
+
+		close(sub.ch)
+	})
+}
+
+type topic[T any] struct {
+	name        string
+	config      config
+	pm          sync.Mutex
+	m           sync.Mutex
+	subscribers map[*subscriber[T]]struct{}
+	done        chan struct{}
+	closed      bool
+}
+
+// NewTopic returns new standalone Topic
+func NewTopic[T any](options ...Option) (Topic[T], error) {
+	c, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTopic[T]("", c), nil
+}
+
+func newTopic[T any](name string, c config) *topic[T] {
+	return &topic[T]{
+		name:        name,
+		config:      c,
+		subscribers: make(map[*subscriber[T]]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (t *topic[T]) Name() string {
+	return t.name
+}
+
+func (t *topic[T]) Publish(ctx context.Context, value T) error {
+	// publishers are serialized to preserve order of values, subscribers are delivered to without holding topic lock
+	t.pm.Lock()
+	defer t.pm.Unlock()
+
+	t.m.Lock()
+
+	if t.closed {
+		t.m.Unlock()
+
+		return ErrClosed
+	}
+
+	subs := make([]*subscriber[T], 0, len(t.subscribers))
+
+	for sub := range t.subscribers {
+		subs = append(subs, sub)
+	}
+
+	t.m.Unlock()
+
+	for _, sub := range subs {
+		if err := t.deliver(ctx, sub, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver sends value to the subscriber, applying overflow policy if its buffer is full
+func (t *topic[T]) deliver(ctx context.Context, sub *subscriber[T], value T) error {
+	sub.m.Lock()
+	defer sub.m.Unlock()
+
+	select {
+	case <-sub.done:
+		return nil
+	case sub.ch <- value:
+		return nil
+	default:
+	}
+
+	switch t.config.policy {
+	case OverflowDropNewest:
+	case OverflowBlock:
+		select {
+		case sub.ch <- value:
+		case <-sub.done:
+		case <-sub.ctx.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	default:
+		// subscriber lock is held, so there are no concurrent senders and the buffer has space after discarding
+		if t.config.buffer > 0 {
+			select {
+			case <-sub.ch:
+			default:
+			}
+		}
+
+		select {
+		case sub.ch <- value:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (t *topic[T]) Subscribe(ctx context.Context) (<-chan T, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &subscriber[T]{
+		ch:   make(chan T, t.config.buffer),
+		ctx:  ctx,
+		done: make(chan struct{}),
+	}
+
+	t.subscribers[sub] = struct{}{}
+
+	go t.unsubscribe(sub)
+
+	return sub.ch, nil
+}
+
+func (t *topic[T]) unsubscribe(sub *subscriber[T]) {
+	select {
+	case <-sub.ctx.Done():
+	case <-t.done:
+		return
+	}
+
+	t.m.Lock()
+
+	_, ok := t.subscribers[sub]
+	if ok {
+		delete(t.subscribers, sub)
+	}
+
+	t.m.Unlock()
+
+	if ok {
+		sub.close()
+	}
+}
+
+func (t *topic[T]) Subscribers() int {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return len(t.subscribers)
+}
+
+func (t *topic[T]) Close() {
+	t.m.Lock()
+
+	if t.closed {
+		t.m.Unlock()
+
+		return
+	}
+
+	t.closed = true
+
+	subs := t.subscribers
+
+	t.subscribers = nil
+
+	close(t.done)
+
+	t.m.Unlock()
+
+	for sub := range subs {
+		sub.close()
+	}
+}
+
+// Broker is a set of named topics sharing configuration, see Get
+type Broker interface {
+	// Topics returns names of existing topics, sorted
+	Topics() []string
+
+	// Remove closes topic with provided name and removes it from the broker, so it no longer occupies memory;
+	// topic obtained with Get afterwards is a new one
+	Remove(name string)
+
+	// Close closes all topics, further topics can't be created
+	Close()
+
+	// topic returns existing topic with provided name, or creates it
+	topic(name string, create func(c config) closer) (closer, error)
+}
+
+type closer interface {
+	Close()
+}
+
+type broker struct {
+	config config
+	m      sync.Mutex
+	topics map[string]closer
+	closed bool
+}
+
+// New returns new Broker, options are applied to all of its topics
+func New(options ...Option) (Broker, error) {
+	c, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &broker{
+		config: c,
+		topics: make(map[string]closer),
+	}, nil
+}
+
+// Get returns topic of the broker with provided name, creating it on first use. Returns ErrTopicType if topic was
+// created with another value type, or ErrClosed if broker is closed.
+func Get[T any](b Broker, name string) (Topic[T], error) {
+	c, err := b.topic(name, func(c config) closer {
+		return newTopic[T](name, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := c.(*topic[T])
+	if !ok {
+		return nil, ErrTopicType
+	}
+
+	return t, nil
+}
+
+func (b *broker) topic(name string, create func(c config) closer) (closer, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	t, ok := b.topics[name]
+	if !ok {
+		t = create(b.config)
+		b.topics[name] = t
+	}
+
+	return t, nil
+}
+
+func (b *broker) Topics() []string {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	res := make([]string, 0, len(b.topics))
+
+	for name := range b.topics {
+		res = append(res, name)
+	}
+
+	sort.Strings(res)
+
+	return res
+}
+
+func (b *broker) Remove(name string) {
+	b.m.Lock()
+
+	t, ok := b.topics[name]
+	if ok {
+		delete(b.topics, name)
+	}
+
+	b.m.Unlock()
+
+	if ok {
+		t.Close()
+	}
+}
+
+func (b *broker) Close() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.closed = true
+
+	for _, t := range b.topics {
+		t.Close()
+	}
+}
@@ -0,0 +1,207 @@
+package broker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/stretchr/testify/assert"
+)
+
+func drain[T any](ch <-chan T) (res []T) {
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return res
+			}
+
+			res = append(res, v)
+		default:
+			return res
+		}
+	}
+}
+
+func TestTopic(t *testing.T) {
+	topic, err := NewTopic[int](WithBuffer(2))
+	assert.NoError(t, err)
+
+	ctx := mutable.NewMutableContext(context.Background())
+
+	ch1, err := topic.Subscribe(ctx)
+	assert.NoError(t, err)
+
+	ch2, err := topic.Subscribe(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, topic.Subscribers())
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, topic.Publish(context.Background(), i))
+	}
+
+	// oldest values are dropped by default
+	assert.Equal(t, []int{2, 3}, drain(ch1))
+	assert.Equal(t, []int{2, 3}, drain(ch2))
+
+	ctx.Cancel()
+
+	_, ok := <-ch1
+	assert.False(t, ok)
+
+	assert.Eventually(t, func() bool {
+		return topic.Subscribers() == 1
+	}, time.Second, time.Millisecond)
+
+	topic.Close()
+	topic.Close()
+
+	_, ok = <-ch2
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, topic.Publish(context.Background(), 4), ErrClosed)
+
+	_, err = topic.Subscribe(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+
+	_, err = NewTopic[int](WithBuffer(-1))
+	assert.Error(t, err)
+}
+
+func TestTopicOverflow(t *testing.T) {
+	topic, err := NewTopic[string](WithBuffer(1), WithOverflowPolicy(OverflowDropNewest))
+	assert.NoError(t, err)
+
+	ch, err := topic.Subscribe(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, topic.Publish(context.Background(), "a"))
+	assert.NoError(t, topic.Publish(context.Background(), "b"))
+	assert.Equal(t, []string{"a"}, drain(ch))
+
+	topic, err = NewTopic[string](WithBuffer(1), WithOverflowPolicy(OverflowBlock))
+	assert.NoError(t, err)
+
+	ch, err = topic.Subscribe(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, topic.Publish(context.Background(), "a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	assert.ErrorIs(t, topic.Publish(ctx, "b"), context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		<-ch
+	}()
+
+	assert.NoError(t, topic.Publish(context.Background(), "c"))
+	assert.Equal(t, []string{"c"}, drain(ch))
+
+	// blocked publishing is released once subscriber is gone
+	topic, err = NewTopic[string](WithBuffer(1), WithOverflowPolicy(OverflowBlock))
+	assert.NoError(t, err)
+
+	subctx := mutable.NewMutableContext(context.Background())
+
+	ch, err = topic.Subscribe(subctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, topic.Publish(context.Background(), "d"))
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		subctx.Cancel()
+	}()
+
+	assert.NoError(t, topic.Publish(context.Background(), "e"))
+	assert.Equal(t, []string{"d"}, drain(ch))
+
+	assert.Eventually(t, func() bool {
+		return topic.Subscribers() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestTopicOverflowBlockUnlocked(t *testing.T) {
+	topic, err := NewTopic[int](WithBuffer(1), WithOverflowPolicy(OverflowBlock))
+	assert.NoError(t, err)
+
+	ch, err := topic.Subscribe(context.Background())
+	assert.NoError(t, err)
+
+	assert.NoError(t, topic.Publish(context.Background(), 1))
+
+	published := make(chan error, 1)
+
+	go func() {
+		published <- topic.Publish(context.Background(), 2)
+	}()
+
+	// blocked publishing does not stall other topic methods
+	time.Sleep(time.Millisecond * 10)
+
+	assert.Equal(t, 1, topic.Subscribers())
+
+	other, err := topic.Subscribe(context.Background())
+	assert.NoError(t, err)
+
+	topic.Close()
+
+	assert.NoError(t, <-published)
+	assert.Equal(t, []int{1}, drain(ch))
+
+	_, ok := <-other
+	assert.False(t, ok)
+}
+
+func TestBroker(t *testing.T) {
+	b, err := New(WithBuffer(1))
+	assert.NoError(t, err)
+
+	foo, err := Get[int](b, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", foo.Name())
+
+	same, err := Get[int](b, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, foo, same)
+
+	_, err = Get[string](b, "foo")
+	assert.ErrorIs(t, err, ErrTopicType)
+
+	bar, err := Get[string](b, "bar")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"bar", "foo"}, b.Topics())
+
+	removed, err := Get[int](b, "removed")
+	assert.NoError(t, err)
+
+	b.Remove("removed")
+	b.Remove("missing")
+
+	assert.Equal(t, []string{"bar", "foo"}, b.Topics())
+	assert.ErrorIs(t, removed.Publish(context.Background(), 1), ErrClosed)
+
+	_, err = Get[string](b, "removed")
+	assert.NoError(t, err)
+
+	b.Remove("removed")
+
+	ch, err := bar.Subscribe(context.Background())
+	assert.NoError(t, err)
+
+	b.Close()
+
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	assert.ErrorIs(t, foo.Publish(context.Background(), 1), ErrClosed)
+
+	_, err = Get[int](b, "baz")
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,43 @@
+package broker
+
+import (
+	"github.com/graphql-go/graphql"
+)
+
+// Subscribe returns graphql.Field Subscribe function subscribing operation to the topic until its context is done.
+// Published values are available to field Resolve function as p.Source.
+func Subscribe[T any](t Topic[T]) graphql.FieldResolveFn {
+	return SubscribeFilter(t, nil)
+}
+
+// SubscribeFilter returns graphql.Field Subscribe function same as Subscribe, passing only values filter returns true
+// for, e.g. depending on field arguments
+func SubscribeFilter[T any](t Topic[T], filter func(p graphql.ResolveParams, value T) bool) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		values, err := t.Subscribe(p.Context)
+		if err != nil {
+			return nil, err
+		}
+
+		// per graphql-go contract, channel returned from Subscribe function must have interface{} values
+		ch := make(chan interface{})
+
+		go func() {
+			defer close(ch)
+
+			for v := range values {
+				if filter != nil && !filter(p, v) {
+					continue
+				}
+
+				select {
+				case ch <- v:
+				case <-p.Context.Done():
+					return
+				}
+			}
+		}()
+
+		return ch, nil
+	}
+}
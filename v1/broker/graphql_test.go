@@ -0,0 +1,136 @@
+package broker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	topic, err := NewTopic[int]()
+	assert.NoError(t, err)
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"updates": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: Subscribe(topic),
+				},
+				"evenUpdates": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: SubscribeFilter(topic, func(p graphql.ResolveParams, value int) bool {
+						return value%2 == 0
+					}),
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	server, err := wsgraphql.NewServer(schema)
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type:    apollows.OperationConnectionInit,
+		Payload: apollows.Data{},
+	}))
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	for id, query := range map[string]string{
+		"1": `subscription { updates }`,
+		"2": `subscription { evenUpdates }`,
+	} {
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			ID:   id,
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: query,
+				},
+			},
+		}))
+	}
+
+	assert.Eventually(t, func() bool {
+		return topic.Subscribers() == 2
+	}, time.Second, time.Millisecond)
+
+	for i := 1; i <= 2; i++ {
+		assert.NoError(t, topic.Publish(context.Background(), i))
+	}
+
+	received := make(map[string][]string)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		received[msg.ID] = append(received[msg.ID], string(msg.Payload.RawMessage))
+	}
+
+	assert.Equal(t, map[string][]string{
+		"1": {`{"data":{"updates":1}}`, `{"data":{"updates":2}}`},
+		"2": {`{"data":{"evenUpdates":2}}`},
+	}, received)
+
+	// operation stopped by the client is unsubscribed
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationComplete,
+	}))
+
+	assert.Eventually(t, func() bool {
+		return topic.Subscribers() == 1
+	}, time.Second, time.Millisecond)
+
+	// closed topic completes remaining subscription
+	topic.Close()
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+	assert.Equal(t, "2", msg.ID)
+}
@@ -0,0 +1,255 @@
+package wsgraphql
+
+import (
+	"net/http"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+)
+
+// ChainCallbacks combines multiple Callbacks into one, calling handlers of each hook in provided order, skipping
+// unset ones.
+// Handlers of OnRequest, OnConnect, OnOperation, OnOperationValidation and OnOperationResult stop at the first error,
+// which is returned.
+// Handlers of OnDisconnect and OnOperationDone are all called, each receiving error returned by the previous one.
+// Handlers of OnRequestDone and OnOverflow are all called.
+func ChainCallbacks(callbacks ...Callbacks) Callbacks {
+	return Callbacks{
+		OnRequest:             chainOnRequest(callbacks),
+		OnRequestDone:         chainOnRequestDone(callbacks),
+		OnConnect:             chainOnConnect(callbacks),
+		OnDisconnect:          chainOnDisconnect(callbacks),
+		OnOperation:           chainOnOperation(callbacks),
+		OnOperationValidation: chainOnOperationValidation(callbacks),
+		OnOperationResult:     chainOnOperationResult(callbacks),
+		OnOperationDone:       chainOnOperationDone(callbacks),
+		OnOverflow:            chainOnOverflow(callbacks),
+	}
+}
+
+func chainOnRequest(callbacks []Callbacks) func(mutable.Context, *http.Request, http.ResponseWriter) error {
+	var fns []func(mutable.Context, *http.Request, http.ResponseWriter) error
+
+	for _, c := range callbacks {
+		if c.OnRequest != nil {
+			fns = append(fns, c.OnRequest)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter) error {
+		for _, fn := range fns {
+			if err := fn(reqctx, r, w); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func chainOnRequestDone(callbacks []Callbacks) func(mutable.Context, *http.Request, http.ResponseWriter, error) {
+	var fns []func(mutable.Context, *http.Request, http.ResponseWriter, error)
+
+	for _, c := range callbacks {
+		if c.OnRequestDone != nil {
+			fns = append(fns, c.OnRequestDone)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter, origerr error) {
+		for _, fn := range fns {
+			fn(reqctx, r, w, origerr)
+		}
+	}
+}
+
+func chainOnConnect(callbacks []Callbacks) func(mutable.Context, apollows.PayloadInit) error {
+	var fns []func(mutable.Context, apollows.PayloadInit) error
+
+	for _, c := range callbacks {
+		if c.OnConnect != nil {
+			fns = append(fns, c.OnConnect)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(reqctx mutable.Context, init apollows.PayloadInit) error {
+		for _, fn := range fns {
+			if err := fn(reqctx, init); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func chainOnDisconnect(callbacks []Callbacks) func(mutable.Context, error) error {
+	var fns []func(mutable.Context, error) error
+
+	for _, c := range callbacks {
+		if c.OnDisconnect != nil {
+			fns = append(fns, c.OnDisconnect)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(reqctx mutable.Context, origerr error) error {
+		for _, fn := range fns {
+			origerr = fn(reqctx, origerr)
+		}
+
+		return origerr
+	}
+}
+
+func chainOnOperation(callbacks []Callbacks) func(mutable.Context, *apollows.PayloadOperation) error {
+	var fns []func(mutable.Context, *apollows.PayloadOperation) error
+
+	for _, c := range callbacks {
+		if c.OnOperation != nil {
+			fns = append(fns, c.OnOperation)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+		for _, fn := range fns {
+			if err := fn(opctx, payload); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func chainOnOperationValidation(
+	callbacks []Callbacks,
+) func(mutable.Context, *apollows.PayloadOperation, *graphql.Result) error {
+	var fns []func(mutable.Context, *apollows.PayloadOperation, *graphql.Result) error
+
+	for _, c := range callbacks {
+		if c.OnOperationValidation != nil {
+			fns = append(fns, c.OnOperationValidation)
+		}
+	}
+
+	return chainResultHandlers(fns)
+}
+
+func chainOnOperationResult(
+	callbacks []Callbacks,
+) func(mutable.Context, *apollows.PayloadOperation, *graphql.Result) error {
+	var fns []func(mutable.Context, *apollows.PayloadOperation, *graphql.Result) error
+
+	for _, c := range callbacks {
+		if c.OnOperationResult != nil {
+			fns = append(fns, c.OnOperationResult)
+		}
+	}
+
+	return chainResultHandlers(fns)
+}
+
+func chainResultHandlers(
+	fns []func(mutable.Context, *apollows.PayloadOperation, *graphql.Result) error,
+) func(mutable.Context, *apollows.PayloadOperation, *graphql.Result) error {
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(opctx mutable.Context, payload *apollows.PayloadOperation, result *graphql.Result) error {
+		for _, fn := range fns {
+			if err := fn(opctx, payload, result); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func chainOnOperationDone(callbacks []Callbacks) func(mutable.Context, *apollows.PayloadOperation, error) error {
+	var fns []func(mutable.Context, *apollows.PayloadOperation, error) error
+
+	for _, c := range callbacks {
+		if c.OnOperationDone != nil {
+			fns = append(fns, c.OnOperationDone)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error {
+		for _, fn := range fns {
+			origerr = fn(opctx, payload, origerr)
+		}
+
+		return origerr
+	}
+}
+
+func chainOnOverflow(callbacks []Callbacks) func(mutable.Context, OverflowPolicy) {
+	var fns []func(mutable.Context, OverflowPolicy)
+
+	for _, c := range callbacks {
+		if c.OnOverflow != nil {
+			fns = append(fns, c.OnOverflow)
+		}
+	}
+
+	switch len(fns) {
+	case 0:
+		return nil
+	case 1:
+		return fns[0]
+	}
+
+	return func(opctx mutable.Context, policy OverflowPolicy) {
+		for _, fn := range fns {
+			fn(opctx, policy)
+		}
+	}
+}
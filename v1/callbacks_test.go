@@ -0,0 +1,107 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainCallbacks(t *testing.T) {
+	var calls []string
+
+	errFirst := errors.New("first")
+	errSecond := errors.New("second")
+
+	chained := ChainCallbacks(
+		Callbacks{
+			OnConnect: func(reqctx mutable.Context, init apollows.PayloadInit) error {
+				calls = append(calls, "connect1")
+
+				return errFirst
+			},
+			OnOperationDone: func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error {
+				calls = append(calls, "done1")
+
+				assert.Nil(t, origerr)
+
+				return errFirst
+			},
+		},
+		Callbacks{},
+		Callbacks{
+			OnConnect: func(reqctx mutable.Context, init apollows.PayloadInit) error {
+				calls = append(calls, "connect2")
+
+				return nil
+			},
+			OnOperationDone: func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error {
+				calls = append(calls, "done2")
+
+				assert.ErrorIs(t, origerr, errFirst)
+
+				return errSecond
+			},
+		},
+	)
+
+	ctx := mutable.NewMutableContext(context.Background())
+
+	assert.ErrorIs(t, chained.OnConnect(ctx, nil), errFirst)
+	assert.ErrorIs(t, chained.OnOperationDone(ctx, nil, nil), errSecond)
+	assert.Equal(t, []string{"connect1", "done1", "done2"}, calls)
+	assert.Nil(t, chained.OnRequest)
+	assert.Nil(t, chained.OnOverflow)
+}
+
+func TestNewServerWithCallbacksComposed(t *testing.T) {
+	var calls []string
+
+	errRejected := errors.New("rejected")
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithCallbacks(Callbacks{
+			OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+				calls = append(calls, "auth")
+
+				return nil
+			},
+			OnRequestDone: func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter, origerr error) {
+				WriteError(reqctx, w, origerr)
+			},
+		}),
+		WithCallbacks(Callbacks{
+			OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+				calls = append(calls, "limit")
+
+				return errRejected
+			},
+			OnRequestDone: func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter, origerr error) {
+				calls = append(calls, "done")
+
+				// error already written by previous handler
+				WriteError(reqctx, w, origerr)
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"query { getFoo }"}`))
+
+	req.Header.Set("content-type", "application/json")
+
+	rec := httptest.NewRecorder()
+
+	server.ServeHTTP(rec, req)
+
+	assert.Equal(t, 1, strings.Count(rec.Body.String(), errRejected.Error()))
+	assert.Equal(t, []string{"auth", "limit", "done"}, calls)
+}
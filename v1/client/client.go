@@ -0,0 +1,504 @@
+// Package client provides websocket client for graphql-ws and graphql-transport-ws subprotocols
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+)
+
+var (
+	// ErrClosed indicates operation was attempted on a closed client
+	ErrClosed = errors.New("client closed")
+
+	// ErrNoResult indicates operation was completed by the server without sending any result
+	ErrNoResult = errors.New("operation completed without result")
+)
+
+// Dialer interface used to establish websocket Conn (interface in image of gorilla websocket dialer)
+type Dialer interface {
+	Dial(ctx context.Context, url string, requestHeader http.Header) (wsgraphql.Conn, error)
+}
+
+// Client to a graphql websocket server
+type Client interface {
+	// Subscribe starts an operation, returning channel of results, which is closed once operation is complete.
+	// Operation terminated with an error will yield a single Result with Err set before the channel is closed.
+	// Cancelling provided context stops the operation.
+	Subscribe(ctx context.Context, payload apollows.PayloadOperation) (<-chan Result, error)
+
+	// Query executes query operation, returning its result, or context error if it was cancelled before any result
+	Query(ctx context.Context, payload apollows.PayloadOperation) (*apollows.PayloadDataResponse, error)
+
+	// Mutate executes mutation operation, returning its result
+	Mutate(ctx context.Context, payload apollows.PayloadOperation) (*apollows.PayloadDataResponse, error)
+
+	// Protocol returns subprotocol negotiated with the server
+	Protocol() apollows.Protocol
+
+	// Done returns channel closed once client connection is terminated
+	Done() <-chan struct{}
+
+	// Err returns error terminated the client connection, if any
+	Err() error
+
+	// Close terminates client connection and all pending operations
+	Close() error
+}
+
+// Result of an operation: either server response or error terminating the operation
+type Result struct {
+	Response *apollows.PayloadDataResponse
+	Err      error
+}
+
+// OperationError is returned when operation is terminated by server with an error message
+type OperationError struct {
+	Errors []apollows.PayloadError
+}
+
+// Error implementation
+func (e OperationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Message)
+	}
+
+	return "operation error: " + strings.Join(msgs, "; ")
+}
+
+// ConnectionError is returned when server rejects connection initialization
+type ConnectionError struct {
+	apollows.PayloadError
+}
+
+// Error implementation
+func (e ConnectionError) Error() string {
+	return "connection error: " + e.Message
+}
+
+type operationMessage struct {
+	result Result
+	final  bool
+}
+
+type operation struct {
+	incoming chan operationMessage
+	finished chan struct{}
+}
+
+type clientImpl struct {
+	nextID     uint64 // accessed atomically, kept first for 64-bit alignment
+	err        error
+	conn       wsgraphql.Conn
+	operations map[string]*operation
+	ack        chan struct{}
+	done       chan struct{}
+	protocol   apollows.Protocol
+	m          sync.Mutex
+	wm         sync.Mutex
+	ackOnce    sync.Once
+	doneOnce   sync.Once
+}
+
+// Dial connects to graphql websocket server at provided url, negotiating one of configured subprotocols and awaiting
+// connection acknowledgement
+func Dial(ctx context.Context, dialer Dialer, url string, options ...Option) (Client, error) {
+	var c clientConfig
+
+	for _, o := range options {
+		err := o(&c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.protocols) == 0 {
+		c.protocols = []apollows.Protocol{
+			apollows.WebsocketSubprotocolGraphqlTransportWS,
+			apollows.WebsocketSubprotocolGraphqlWS,
+		}
+	}
+
+	header := c.header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	var protocols []string
+
+	for _, p := range c.protocols {
+		protocols = append(protocols, p.String())
+	}
+
+	header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+
+	conn, err := dialer.Dial(ctx, url, header)
+	if err != nil {
+		return nil, err
+	}
+
+	protocol := apollows.Protocol(conn.Subprotocol())
+
+	var known bool
+
+	for _, p := range c.protocols {
+		if p == protocol {
+			known = true
+
+			break
+		}
+	}
+
+	if !known {
+		_ = conn.Close(int(apollows.EventCloseNormal), apollows.ErrUnknownProtocol.Error())
+
+		return nil, apollows.ErrUnknownProtocol
+	}
+
+	cl := &clientImpl{
+		conn:       conn,
+		operations: make(map[string]*operation),
+		ack:        make(chan struct{}),
+		done:       make(chan struct{}),
+		protocol:   protocol,
+	}
+
+	init := apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}
+
+	if c.init != nil {
+		init.Payload.Value = c.init
+	}
+
+	err = cl.write(&init)
+	if err != nil {
+		_ = conn.Close(int(apollows.EventCloseNormal), err.Error())
+
+		return nil, err
+	}
+
+	go cl.read()
+
+	select {
+	case <-cl.ack:
+		return cl, nil
+	case <-cl.done:
+		return nil, cl.err
+	case <-ctx.Done():
+		cl.fail(ctx.Err())
+
+		return nil, ctx.Err()
+	}
+}
+
+func (cl *clientImpl) write(msg *apollows.Message) error {
+	cl.wm.Lock()
+	defer cl.wm.Unlock()
+
+	return cl.conn.WriteJSON(msg)
+}
+
+func (cl *clientImpl) fail(err error) {
+	cl.doneOnce.Do(func() {
+		cl.err = err
+
+		close(cl.done)
+
+		cl.wm.Lock()
+		_ = cl.conn.Close(int(apollows.EventCloseNormal), "")
+		cl.wm.Unlock()
+	})
+}
+
+func (cl *clientImpl) deliver(id string, msg operationMessage) {
+	cl.m.Lock()
+	op, ok := cl.operations[id]
+	cl.m.Unlock()
+
+	if !ok {
+		return
+	}
+
+	select {
+	case op.incoming <- msg:
+	case <-op.finished:
+	}
+}
+
+func (cl *clientImpl) readError(msg *apollows.Message) error {
+	pds, err := msg.Payload.ReadPayloadErrors()
+	if err == nil {
+		var errs []apollows.PayloadError
+
+		for _, pd := range pds {
+			if pd != nil {
+				errs = append(errs, *pd)
+			}
+		}
+
+		return OperationError{
+			Errors: errs,
+		}
+	}
+
+	pd, err := msg.Payload.ReadPayloadError()
+	if err != nil {
+		return err
+	}
+
+	return OperationError{
+		Errors: []apollows.PayloadError{*pd},
+	}
+}
+
+func (cl *clientImpl) readMessage(msg *apollows.Message) (err error) {
+	switch msg.Type {
+	case apollows.OperationConnectionAck:
+		cl.ackOnce.Do(func() {
+			close(cl.ack)
+		})
+	case apollows.OperationConnectionError:
+		var pd *apollows.PayloadError
+
+		pd, err = msg.Payload.ReadPayloadError()
+		if err != nil {
+			return
+		}
+
+		return ConnectionError{
+			PayloadError: *pd,
+		}
+	case apollows.OperationPing:
+		return cl.write(&apollows.Message{
+			Type:    apollows.OperationPong,
+			Payload: msg.Payload,
+		})
+	case apollows.OperationData, apollows.OperationNext:
+		pd, perr := msg.Payload.ReadPayloadData()
+
+		cl.deliver(msg.ID, operationMessage{
+			result: Result{
+				Response: pd,
+				Err:      perr,
+			},
+		})
+	case apollows.OperationError:
+		cl.deliver(msg.ID, operationMessage{
+			result: Result{
+				Err: cl.readError(msg),
+			},
+			final: true,
+		})
+	case apollows.OperationComplete:
+		cl.deliver(msg.ID, operationMessage{
+			final: true,
+		})
+	}
+
+	return
+}
+
+func (cl *clientImpl) read() {
+	var err error
+
+	defer func() {
+		cl.fail(err)
+	}()
+
+	for {
+		var msg apollows.Message
+
+		err = cl.conn.ReadJSON(&msg)
+		if err != nil {
+			return
+		}
+
+		err = cl.readMessage(&msg)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (cl *clientImpl) serveOperation(ctx context.Context, id string, op *operation, results chan<- Result) {
+	defer func() {
+		cl.m.Lock()
+		delete(cl.operations, id)
+		cl.m.Unlock()
+
+		close(op.finished)
+		close(results)
+	}()
+
+	for {
+		select {
+		case msg := <-op.incoming:
+			if msg.result.Response != nil || msg.result.Err != nil {
+				select {
+				case results <- msg.result:
+				case <-ctx.Done():
+					cl.stop(id)
+
+					return
+				}
+			}
+
+			if msg.final {
+				return
+			}
+		case <-ctx.Done():
+			cl.stop(id)
+
+			return
+		case <-cl.done:
+			select {
+			case results <- Result{
+				Err: cl.Err(),
+			}:
+			case <-ctx.Done():
+			}
+
+			return
+		}
+	}
+}
+
+func (cl *clientImpl) stop(id string) {
+	t := apollows.OperationComplete
+
+	if cl.protocol == apollows.WebsocketSubprotocolGraphqlWS {
+		t = apollows.OperationStop
+	}
+
+	err := cl.write(&apollows.Message{
+		ID:   id,
+		Type: t,
+	})
+	if err != nil {
+		cl.fail(err)
+	}
+}
+
+func (cl *clientImpl) Subscribe(ctx context.Context, payload apollows.PayloadOperation) (<-chan Result, error) {
+	select {
+	case <-cl.done:
+		return nil, cl.Err()
+	default:
+	}
+
+	id := strconv.FormatUint(atomic.AddUint64(&cl.nextID, 1), 10)
+
+	op := &operation{
+		incoming: make(chan operationMessage),
+		finished: make(chan struct{}),
+	}
+
+	cl.m.Lock()
+	cl.operations[id] = op
+	cl.m.Unlock()
+
+	t := apollows.OperationSubscribe
+
+	if cl.protocol == apollows.WebsocketSubprotocolGraphqlWS {
+		t = apollows.OperationStart
+	}
+
+	err := cl.write(&apollows.Message{
+		ID:   id,
+		Type: t,
+		Payload: apollows.Data{
+			Value: payload,
+		},
+	})
+	if err != nil {
+		cl.m.Lock()
+		delete(cl.operations, id)
+		cl.m.Unlock()
+
+		cl.fail(err)
+
+		return nil, err
+	}
+
+	results := make(chan Result, 1)
+
+	go cl.serveOperation(ctx, id, op, results)
+
+	return results, nil
+}
+
+func (cl *clientImpl) Query(
+	ctx context.Context,
+	payload apollows.PayloadOperation,
+) (resp *apollows.PayloadDataResponse, err error) {
+	results, err := cl.Subscribe(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	for res := range results {
+		if res.Err != nil {
+			err = res.Err
+
+			continue
+		}
+
+		if resp == nil {
+			resp = res.Response
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp == nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		return nil, ErrNoResult
+	}
+
+	return resp, nil
+}
+
+func (cl *clientImpl) Mutate(
+	ctx context.Context,
+	payload apollows.PayloadOperation,
+) (*apollows.PayloadDataResponse, error) {
+	return cl.Query(ctx, payload)
+}
+
+func (cl *clientImpl) Protocol() apollows.Protocol {
+	return cl.protocol
+}
+
+func (cl *clientImpl) Done() <-chan struct{} {
+	return cl.done
+}
+
+func (cl *clientImpl) Err() error {
+	select {
+	case <-cl.done:
+		return cl.err
+	default:
+		return nil
+	}
+}
+
+func (cl *clientImpl) Close() error {
+	cl.fail(ErrClosed)
+
+	return nil
+}
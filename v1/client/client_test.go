@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/compat/gorillaws"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getFoo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{
+			Name: "MutationRoot",
+			Fields: graphql.Fields{
+				"setFoo": &graphql.Field{
+					Args: graphql.FieldConfigArgument{
+						"value": &graphql.ArgumentConfig{
+							Type: graphql.Int,
+						},
+					},
+					Type: graphql.Boolean,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						_, ok := p.Args["value"].(int)
+
+						return ok, nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"fooUpdates": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{}, 3)
+
+						ch <- 1
+						ch <- 2
+						ch <- 3
+
+						close(ch)
+
+						return ch, nil
+					},
+				},
+				"forever": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{})
+
+						return ch, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+func testNewServer(t *testing.T, opts ...wsgraphql.ServerOption) *httptest.Server {
+	opts = append(opts, wsgraphql.WithUpgrader(gorillaws.Wrap(&websocket.Upgrader{
+		Subprotocols: []string{
+			apollows.WebsocketSubprotocolGraphqlWS.String(),
+			apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+		},
+	})))
+
+	server, err := wsgraphql.NewServer(testNewSchema(t), opts...)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func testDial(t *testing.T, srv *httptest.Server, opts ...Option) Client {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+	defer cancel()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	cl, err := Dial(ctx, gorillaws.WrapDialer(websocket.DefaultDialer), u, opts...)
+
+	assert.NoError(t, err)
+	assert.NotNil(t, cl)
+
+	return cl
+}
+
+func testClient(t *testing.T, protocol apollows.Protocol) {
+	srv := testNewServer(t)
+
+	defer srv.Close()
+
+	cl := testDial(t, srv, WithProtocol(protocol))
+
+	defer func() {
+		assert.NoError(t, cl.Close())
+	}()
+
+	assert.Equal(t, protocol, cl.Protocol())
+
+	ctx := context.Background()
+
+	pd, err := cl.Query(ctx, apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	})
+
+	assert.NoError(t, err)
+	assert.Len(t, pd.Errors, 0)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	pd, err = cl.Mutate(ctx, apollows.PayloadOperation{
+		Query: `mutation { setFoo(value: 3) }`,
+	})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, true, pd.Data["setFoo"])
+
+	_, err = cl.Query(ctx, apollows.PayloadOperation{
+		Query: `query { bar }`,
+	})
+
+	var operr OperationError
+
+	assert.True(t, errors.As(err, &operr))
+	assert.Contains(t, operr.Error(), `Cannot query field "bar"`)
+
+	results, err := cl.Subscribe(ctx, apollows.PayloadOperation{
+		Query: `subscription { fooUpdates }`,
+	})
+
+	assert.NoError(t, err)
+
+	idx := 1
+
+	for res := range results {
+		assert.NoError(t, res.Err)
+		assert.EqualValues(t, idx, res.Response.Data["fooUpdates"])
+
+		idx++
+	}
+
+	assert.Equal(t, 4, idx)
+
+	subctx, cancel := context.WithCancel(ctx)
+
+	results, err = cl.Subscribe(subctx, apollows.PayloadOperation{
+		Query: `subscription { forever }`,
+	})
+
+	assert.NoError(t, err)
+
+	cancel()
+
+	for range results {
+		assert.Fail(t, "unexpected result")
+	}
+
+	pd, err = cl.Query(ctx, apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+}
+
+func TestClientGWS(t *testing.T) {
+	testClient(t, apollows.WebsocketSubprotocolGraphqlWS)
+}
+
+func TestClientGTWS(t *testing.T) {
+	testClient(t, apollows.WebsocketSubprotocolGraphqlTransportWS)
+}
+
+func TestClientDefaultProtocol(t *testing.T) {
+	srv := testNewServer(t)
+
+	defer srv.Close()
+
+	cl := testDial(t, srv)
+
+	assert.NotEmpty(t, cl.Protocol())
+	assert.NoError(t, cl.Close())
+
+	<-cl.Done()
+
+	assert.Equal(t, ErrClosed, cl.Err())
+
+	_, err := cl.Subscribe(context.Background(), apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	})
+
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestClientInitPayload(t *testing.T) {
+	srv := testNewServer(t, wsgraphql.WithCallbacks(wsgraphql.Callbacks{
+		OnConnect: func(reqctx mutable.Context, init apollows.PayloadInit) error {
+			if init["token"] != "secret" {
+				return apollows.EventUnauthorized
+			}
+
+			return nil
+		},
+	}))
+
+	defer srv.Close()
+
+	cl := testDial(t, srv, WithInitPayload(apollows.PayloadInit{
+		"token": "secret",
+	}))
+
+	assert.NoError(t, cl.Close())
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	for _, protocol := range []apollows.Protocol{
+		apollows.WebsocketSubprotocolGraphqlWS,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+	} {
+		_, err := Dial(context.Background(), gorillaws.WrapDialer(websocket.DefaultDialer), u, WithProtocol(protocol))
+
+		assert.Error(t, err)
+	}
+}
+
+func TestClientConnectionLost(t *testing.T) {
+	srv := testNewServer(t, wsgraphql.WithCallbacks(wsgraphql.Callbacks{
+		OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+			if payload.OperationName == "Close" {
+				return apollows.WrapError(errors.New("closed"), apollows.EventInvalidMessage)
+			}
+
+			return nil
+		},
+	}))
+
+	defer srv.Close()
+
+	cl := testDial(t, srv, WithHeader(http.Header{
+		"X-Foo": []string{"bar"},
+	}))
+
+	results, err := cl.Subscribe(context.Background(), apollows.PayloadOperation{
+		Query: `subscription { forever }`,
+	})
+
+	assert.NoError(t, err)
+
+	_, err = cl.Subscribe(context.Background(), apollows.PayloadOperation{
+		Query:         `query Close { getFoo }`,
+		OperationName: "Close",
+	})
+
+	assert.NoError(t, err)
+
+	res, ok := <-results
+
+	assert.True(t, ok)
+	assert.ErrorContains(t, res.Err, "closed")
+
+	_, ok = <-results
+
+	assert.False(t, ok)
+
+	<-cl.Done()
+
+	assert.Error(t, cl.Err())
+}
+
+func TestClientQueryCancel(t *testing.T) {
+	srv := testNewServer(t)
+
+	defer srv.Close()
+
+	cl := testDial(t, srv)
+
+	defer func() {
+		assert.NoError(t, cl.Close())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+
+	defer cancel()
+
+	_, err := cl.Query(ctx, apollows.PayloadOperation{
+		Query: `subscription { forever }`,
+	})
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	pd, err := cl.Query(context.Background(), apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	})
+
+	assert.NoError(t, err)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+}
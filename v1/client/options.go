@@ -0,0 +1,44 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+)
+
+type clientConfig struct {
+	header    http.Header
+	init      apollows.PayloadInit
+	protocols []apollows.Protocol
+}
+
+// Option to configure Client
+type Option func(config *clientConfig) error
+
+// WithProtocol option adds subprotocol offered to the server during negotiation. May be specified multiple times.
+// By default, both graphql-transport-ws and graphql-ws are offered.
+func WithProtocol(protocol apollows.Protocol) Option {
+	return func(config *clientConfig) error {
+		config.protocols = append(config.protocols, protocol)
+
+		return nil
+	}
+}
+
+// WithInitPayload option sets connection params sent with connection_init message
+func WithInitPayload(init apollows.PayloadInit) Option {
+	return func(config *clientConfig) error {
+		config.init = init
+
+		return nil
+	}
+}
+
+// WithHeader option sets additional HTTP headers sent with websocket handshake request
+func WithHeader(header http.Header) Option {
+	return func(config *clientConfig) error {
+		config.header = header
+
+		return nil
+	}
+}
@@ -1,6 +1,17 @@
 package wsgraphql
 
-import "net/http"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/stdws"
+)
 
 // Upgrader interface used to upgrade HTTP request/response pair into a Conn
 type Upgrader interface {
@@ -14,3 +25,144 @@ type Conn interface {
 	Close(code int, message string) error
 	Subprotocol() string
 }
+
+// DeadlineConn is optionally implemented by Conn supporting write deadlines, required for WithWriteTimeout
+type DeadlineConn interface {
+	Conn
+	SetWriteDeadline(t time.Time) error
+}
+
+// ErrWriteTimeout returned when websocket write does not complete within WithWriteTimeout, reported to OnDisconnect
+var ErrWriteTimeout = errors.New("websocket write timeout")
+
+// timeoutConn sets write deadline before every write
+type timeoutConn struct {
+	DeadlineConn
+	timeout time.Duration
+}
+
+func writeTimeoutError(err error) error {
+	var nerr net.Error
+
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &nerr) && nerr.Timeout() {
+		return fmt.Errorf("%w: %v", ErrWriteTimeout, err)
+	}
+
+	return err
+}
+
+func (conn timeoutConn) WriteJSON(v interface{}) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(conn.timeout))
+
+	return writeTimeoutError(conn.DeadlineConn.WriteJSON(v))
+}
+
+func (conn timeoutConn) Close(code int, message string) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(conn.timeout))
+
+	return writeTimeoutError(conn.DeadlineConn.Close(code, message))
+}
+
+// WrapUpgrader returns Upgrader wrapping connections upgraded by provided one, or by standard library upgrader
+// supporting both graphql-ws and graphql-transport-ws if nil. Write deadlines support of upgraded connection is
+// preserved, as required for WithWriteTimeout, so wrap only needs to implement Conn.
+func WrapUpgrader(next Upgrader, wrap func(r *http.Request, conn Conn) Conn) Upgrader {
+	if next == nil {
+		next = NewStdUpgrader(
+			apollows.WebsocketSubprotocolGraphqlTransportWS,
+			apollows.WebsocketSubprotocolGraphqlWS,
+		)
+	}
+
+	return wrappedUpgrader{
+		next: next,
+		wrap: wrap,
+	}
+}
+
+type wrappedUpgrader struct {
+	next Upgrader
+	wrap func(r *http.Request, conn Conn) Conn
+}
+
+func (u wrappedUpgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (Conn, error) {
+	c, err := u.next.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	wc := u.wrap(r, c)
+
+	if _, ok := wc.(DeadlineConn); ok {
+		return wc, nil
+	}
+
+	if dc, ok := c.(DeadlineConn); ok {
+		return wrappedDeadlineConn{
+			Conn:     wc,
+			deadline: dc,
+		}, nil
+	}
+
+	return wc, nil
+}
+
+type wrappedDeadlineConn struct {
+	Conn
+	deadline DeadlineConn
+}
+
+func (c wrappedDeadlineConn) SetWriteDeadline(t time.Time) error {
+	return c.deadline.SetWriteDeadline(t)
+}
+
+type stdUpgrader struct {
+	*stdws.Upgrader
+}
+
+func (u stdUpgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (Conn, error) {
+	c, err := u.Upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewStdUpgrader returns Upgrader based on standard library websocket implementation, negotiating provided
+// subprotocols in order of preference
+func NewStdUpgrader(subprotocols ...Protocol) Upgrader {
+	var strprotocols []string
+
+	for _, p := range subprotocols {
+		strprotocols = append(strprotocols, p.String())
+	}
+
+	return stdUpgrader{
+		Upgrader: &stdws.Upgrader{
+			Subprotocols: strprotocols,
+		},
+	}
+}
+
+// defaultUpgrader returns standard library Upgrader supporting configured protocols, preferring newer ones
+func defaultUpgrader(protocols map[string]Protocol) Upgrader {
+	var subprotocols []Protocol
+
+	for _, p := range protocols {
+		subprotocols = append(subprotocols, p)
+	}
+
+	sort.Slice(subprotocols, func(i, j int) bool {
+		pi, pj := subprotocols[i].String(), subprotocols[j].String()
+		gtws := apollows.WebsocketSubprotocolGraphqlTransportWS.String()
+
+		if (pi == gtws) != (pj == gtws) {
+			return pi == gtws
+		}
+
+		return pi < pj
+	})
+
+	return NewStdUpgrader(subprotocols...)
+}
@@ -0,0 +1,152 @@
+// Package coderws provides compatibility for coder/websocket (formerly nhooyr.io/websocket) upgrader
+package coderws
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// maxCloseReason is maximum length of close reason fitting into close frame
+const maxCloseReason = 123
+
+// Wrapper for coder websocket accept options
+type Wrapper struct {
+	*websocket.AcceptOptions
+
+	// ReadLimit sets maximum size of a message read from the peer, library default is used if not set
+	ReadLimit int64
+}
+
+type conn struct {
+	*websocket.Conn
+	ctx context.Context
+}
+
+// ReadJSON reads next message, respecting request context
+func (conn conn) ReadJSON(v interface{}) error {
+	return wsjson.Read(conn.ctx, conn.Conn, v)
+}
+
+// WriteJSON writes message, respecting request context
+func (conn conn) WriteJSON(v interface{}) error {
+	return wsjson.Write(conn.ctx, conn.Conn, v)
+}
+
+func (conn conn) Close(code int, message string) error {
+	if len(message) > maxCloseReason {
+		message = message[:maxCloseReason]
+
+		for !utf8.ValidString(message) {
+			message = message[:len(message)-1]
+		}
+	}
+
+	return conn.Conn.Close(websocket.StatusCode(code), message)
+}
+
+func (conn conn) Subprotocol() string {
+	return conn.Conn.Subprotocol()
+}
+
+func wrapConn(ctx context.Context, c *websocket.Conn, readLimit int64) conn {
+	if readLimit > 0 {
+		c.SetReadLimit(readLimit)
+	}
+
+	return conn{
+		Conn: c,
+		ctx:  ctx,
+	}
+}
+
+// Upgrade implementation
+func (c Wrapper) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (wsgraphql.Conn, error) {
+	for k, vs := range responseHeader {
+		w.Header()[k] = vs
+	}
+
+	ws, err := websocket.Accept(w, r, c.AcceptOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapConn(r.Context(), ws, c.ReadLimit), nil
+}
+
+// Wrap coder websocket accept options into wsgraphql-compatible interface
+func Wrap(options *websocket.AcceptOptions) Wrapper {
+	return Wrapper{
+		AcceptOptions: options,
+	}
+}
+
+// DialerWrapper for coder websocket dial options
+type DialerWrapper struct {
+	*websocket.DialOptions
+
+	// ReadLimit sets maximum size of a message read from the peer, library default is used if not set
+	ReadLimit int64
+}
+
+// Dial implementation, provided context is only used to establish the connection
+func (d DialerWrapper) Dial(ctx context.Context, url string, requestHeader http.Header) (wsgraphql.Conn, error) {
+	var opts websocket.DialOptions
+
+	if d.DialOptions != nil {
+		opts = *d.DialOptions
+	}
+
+	header := opts.HTTPHeader.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	for k, vs := range requestHeader {
+		header[k] = vs
+	}
+
+	// subprotocols are negotiated by the library itself
+	if protocols := header.Values("Sec-WebSocket-Protocol"); len(protocols) > 0 && len(opts.Subprotocols) == 0 {
+		for _, p := range protocols {
+			opts.Subprotocols = append(opts.Subprotocols, splitTokens(p)...)
+		}
+	}
+
+	header.Del("Sec-WebSocket-Protocol")
+
+	opts.HTTPHeader = header
+
+	ws, resp, err := websocket.Dial(ctx, url, &opts)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapConn(context.Background(), ws, d.ReadLimit), nil
+}
+
+// WrapDialer wraps coder websocket dial options into wsgraphql client-compatible interface
+func WrapDialer(options *websocket.DialOptions) DialerWrapper {
+	return DialerWrapper{
+		DialOptions: options,
+	}
+}
+
+func splitTokens(value string) (tokens []string) {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			tokens = append(tokens, part)
+		}
+	}
+
+	return tokens
+}
@@ -0,0 +1,220 @@
+// Package gobwasws provides compatibility for gobwas/ws websocket upgrader
+package gobwasws
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// maxCloseReason is maximum length of close reason fitting into close frame
+const maxCloseReason = 123
+
+// Wrapper for gobwas websocket HTTP upgrader.
+// Note that gobwas upgrader hijacks the connection before validating the request, so origin checks, if required,
+// should be done before the upgrade.
+type Wrapper struct {
+	ws.HTTPUpgrader
+
+	// Subprotocols supported by the server in order of preference, used unless HTTPUpgrader.Protocol is set
+	Subprotocols []string
+
+	// ReadLimit sets maximum size of a frame read from the peer, unlimited if not set
+	ReadLimit int64
+}
+
+// lockedWriter serializes writes of messages and control frame replies
+type lockedWriter struct {
+	io.Writer
+	m *sync.Mutex
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.Writer.Write(p)
+}
+
+type conn struct {
+	net.Conn
+	reader   *wsutil.Reader
+	control  wsutil.FrameHandlerFunc
+	protocol string
+	wm       sync.Mutex
+}
+
+var _ wsgraphql.DeadlineConn = (*conn)(nil)
+
+func (c *conn) ReadJSON(v interface{}) error {
+	for {
+		hdr, err := c.reader.NextFrame()
+		if err != nil {
+			return err
+		}
+
+		if hdr.OpCode.IsControl() {
+			err = c.control(hdr, c.reader)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if hdr.OpCode&(ws.OpText|ws.OpBinary) == 0 {
+			err = c.reader.Discard()
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err = json.NewDecoder(c.reader).Decode(v)
+		if err != nil {
+			return err
+		}
+
+		return c.reader.Discard()
+	}
+}
+
+func (c *conn) WriteJSON(v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.wm.Lock()
+	defer c.wm.Unlock()
+
+	return wsutil.WriteServerMessage(c.Conn, ws.OpText, bs)
+}
+
+func (c *conn) Close(code int, message string) error {
+	if len(message) > maxCloseReason {
+		message = message[:maxCloseReason]
+
+		for !utf8.ValidString(message) {
+			message = message[:len(message)-1]
+		}
+	}
+
+	c.wm.Lock()
+	origerr := ws.WriteFrame(c.Conn, ws.NewCloseFrame(ws.NewCloseFrameBody(ws.StatusCode(code), message)))
+	c.wm.Unlock()
+
+	err := c.Conn.Close()
+	if err == nil {
+		err = origerr
+	}
+
+	return err
+}
+
+func (c *conn) Subprotocol() string {
+	return c.protocol
+}
+
+// selectProtocol returns protocol selection function preferring server-side order of supported subprotocols
+func (c Wrapper) selectProtocol(r *http.Request) func(string) bool {
+	if c.HTTPUpgrader.Protocol != nil || len(c.Subprotocols) == 0 {
+		return c.HTTPUpgrader.Protocol
+	}
+
+	var requested []string
+
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, part := range strings.Split(value, ",") {
+			requested = append(requested, strings.TrimSpace(part))
+		}
+	}
+
+	for _, supported := range c.Subprotocols {
+		for _, p := range requested {
+			if p == supported {
+				return func(s string) bool {
+					return s == supported
+				}
+			}
+		}
+	}
+
+	return func(string) bool {
+		return false
+	}
+}
+
+// Upgrade implementation
+func (c Wrapper) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (wsgraphql.Conn, error) {
+	upgrader := c.HTTPUpgrader
+
+	upgrader.Protocol = c.selectProtocol(r)
+
+	if len(responseHeader) > 0 {
+		header := upgrader.Header.Clone()
+		if header == nil {
+			header = make(http.Header)
+		}
+
+		for k, vs := range responseHeader {
+			header[k] = vs
+		}
+
+		upgrader.Header = header
+	}
+
+	netConn, rw, hs, err := upgrader.Upgrade(r, w)
+	if err != nil {
+		if netConn != nil {
+			_ = netConn.Close()
+		}
+
+		return nil, err
+	}
+
+	// buffered reader is only kept if client already sent some data, to avoid per-connection buffers
+	var src io.Reader = netConn
+
+	if rw != nil && rw.Reader.Buffered() > 0 {
+		src = io.MultiReader(io.LimitReader(rw.Reader, int64(rw.Reader.Buffered())), netConn)
+	}
+
+	res := &conn{
+		Conn:     netConn,
+		protocol: hs.Protocol,
+	}
+
+	res.control = wsutil.ControlFrameHandler(lockedWriter{
+		Writer: netConn,
+		m:      &res.wm,
+	}, ws.StateServerSide)
+
+	res.reader = &wsutil.Reader{
+		Source:         src,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		MaxFrameSize:   c.ReadLimit,
+		OnIntermediate: res.control,
+	}
+
+	return res, nil
+}
+
+// Wrap gobwas HTTP upgrader into wsgraphql-compatible interface, negotiating provided subprotocols in order of
+// preference
+func Wrap(upgrader ws.HTTPUpgrader, subprotocols ...string) Wrapper {
+	return Wrapper{
+		HTTPUpgrader: upgrader,
+		Subprotocols: subprotocols,
+	}
+}
@@ -0,0 +1,142 @@
+package gobwasws
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/client"
+	"github.com/bitquery/wsgraphql/v1/compat/gorillaws"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewServer(t *testing.T, opts ...wsgraphql.ServerOption) *httptest.Server {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"getFoo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 123, nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"fooUpdates": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{}, 3)
+
+						ch <- 1
+						ch <- 2
+						ch <- 3
+
+						close(ch)
+
+						return ch, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	opts = append(opts, wsgraphql.WithUpgrader(Wrapper{
+		Subprotocols: []string{
+			apollows.WebsocketSubprotocolGraphqlWS.String(),
+			apollows.WebsocketSubprotocolGraphqlTransportWS.String(),
+		},
+	}))
+
+	server, err := wsgraphql.NewServer(schema, opts...)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server)
+}
+
+func testDial(t *testing.T, srv *httptest.Server, opts ...client.Option) (client.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+	defer cancel()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	return client.Dial(ctx, gorillaws.WrapDialer(websocket.DefaultDialer), u, opts...)
+}
+
+func TestWrapper(t *testing.T) {
+	srv := testNewServer(t)
+
+	defer srv.Close()
+
+	for _, protocol := range []apollows.Protocol{
+		apollows.WebsocketSubprotocolGraphqlWS,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+	} {
+		cl, err := testDial(t, srv, client.WithProtocol(protocol))
+
+		assert.NoError(t, err)
+		assert.Equal(t, protocol, cl.Protocol())
+
+		ctx := context.Background()
+
+		pd, err := cl.Query(ctx, apollows.PayloadOperation{
+			Query: `query { getFoo }`,
+		})
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+		results, err := cl.Subscribe(ctx, apollows.PayloadOperation{
+			Query: `subscription { fooUpdates }`,
+		})
+
+		assert.NoError(t, err)
+
+		idx := 1
+
+		for res := range results {
+			assert.NoError(t, res.Err)
+			assert.EqualValues(t, idx, res.Response.Data["fooUpdates"])
+
+			idx++
+		}
+
+		assert.Equal(t, 4, idx)
+		assert.NoError(t, cl.Close())
+	}
+}
+
+func TestWrapperClose(t *testing.T) {
+	srv := testNewServer(t, wsgraphql.WithCallbacks(wsgraphql.Callbacks{
+		OnConnect: func(reqctx mutable.Context, init apollows.PayloadInit) error {
+			return apollows.EventUnauthorized
+		},
+	}))
+
+	defer srv.Close()
+
+	_, err := testDial(t, srv, client.WithProtocol(apollows.WebsocketSubprotocolGraphqlTransportWS))
+
+	var closeErr *websocket.CloseError
+
+	assert.True(t, errors.As(err, &closeErr))
+	assert.Equal(t, int(apollows.EventUnauthorized), closeErr.Code)
+}
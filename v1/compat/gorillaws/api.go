@@ -2,6 +2,7 @@
 package gorillaws
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/bitquery/wsgraphql/v1"
@@ -17,6 +18,8 @@ type conn struct {
 	*websocket.Conn
 }
 
+var _ wsgraphql.DeadlineConn = conn{}
+
 func (conn conn) Close(code int, message string) error {
 	origerr := conn.Conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, message))
 
@@ -50,3 +53,31 @@ func Wrap(upgrader *websocket.Upgrader) Wrapper {
 		Upgrader: upgrader,
 	}
 }
+
+// DialerWrapper for gorilla websocket dialer
+type DialerWrapper struct {
+	*websocket.Dialer
+}
+
+// Dial implementation
+func (d DialerWrapper) Dial(ctx context.Context, url string, requestHeader http.Header) (wsgraphql.Conn, error) {
+	c, resp, err := d.Dialer.DialContext(ctx, url, requestHeader)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return conn{
+		Conn: c,
+	}, nil
+}
+
+// WrapDialer wraps gorilla dialer into wsgraphql client-compatible interface
+func WrapDialer(dialer *websocket.Dialer) DialerWrapper {
+	return DialerWrapper{
+		Dialer: dialer,
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/bitquery/wsgraphql/v1/apollows"
 	"github.com/bitquery/wsgraphql/v1/mutable"
 	"github.com/graphql-go/graphql/language/ast"
 )
@@ -19,6 +20,14 @@ type (
 	contextKeyHTTPResponseWriterT  struct{}
 	contextKeyHTTPResponseStartedT struct{}
 	contextKeyWebsocketConnectionT struct{}
+	contextKeyConnectionIDT        struct{}
+	contextKeyOperationCountT      struct{}
+	contextKeyPayloadInitT         struct{}
+	contextKeyCostT                struct{}
+	contextKeyOperationCancelledT  struct{}
+	contextKeyOperationQueueT      struct{}
+	contextKeyWebsocketRequestT    struct{}
+	contextKeyPersistedQueryT      struct{}
 )
 
 var (
@@ -37,6 +46,9 @@ var (
 	// ContextKeyAST used to store operation's ast.Document (abstract syntax tree)
 	ContextKeyAST = contextKeyAstT{}
 
+	// ContextKeyCost used to store operation's static cost, if cost analysis is enabled
+	ContextKeyCost = contextKeyCostT{}
+
 	// ContextKeySubscription used to store operation subscription flag
 	ContextKeySubscription = contextKeySubscriptionT{}
 
@@ -51,6 +63,27 @@ var (
 
 	// ContextKeyWebsocketConnection used to store websocket connection
 	ContextKeyWebsocketConnection = contextKeyWebsocketConnectionT{}
+
+	// ContextKeyConnectionID used to store websocket connection ID, as listed by Server.Connections
+	ContextKeyConnectionID = contextKeyConnectionIDT{}
+
+	// ContextKeyOperationCount used to store number of operations running on websocket connection
+	ContextKeyOperationCount = contextKeyOperationCountT{}
+
+	// ContextKeyPayloadInit used to store websocket connection init payload
+	ContextKeyPayloadInit = contextKeyPayloadInitT{}
+
+	// contextKeyOperationCancelled used to store error operation was cancelled with by Server.CancelOperation
+	contextKeyOperationCancelled = contextKeyOperationCancelledT{}
+
+	// contextKeyOperationQueue used to store outgoing message queue of the operation
+	contextKeyOperationQueue = contextKeyOperationQueueT{}
+
+	// contextKeyWebsocketRequest used to store websocket connection state
+	contextKeyWebsocketRequest = contextKeyWebsocketRequestT{}
+
+	// contextKeyPersistedQuery used to store persisted query to be registered once operation passes validation
+	contextKeyPersistedQuery = contextKeyPersistedQueryT{}
 )
 
 func defaultMutcontext(ctx context.Context, mutctx mutable.Context) mutable.Context {
@@ -144,6 +177,21 @@ func ContextAST(ctx context.Context) *ast.Document {
 	return astdoc
 }
 
+// ContextCost returns operation's static cost, see WithCostAnalysis
+func ContextCost(ctx context.Context) int {
+	v := ctx.Value(ContextKeyCost)
+	if v == nil {
+		return 0
+	}
+
+	cost, ok := v.(int)
+	if !ok {
+		return 0
+	}
+
+	return cost
+}
+
 // ContextSubscription returns operation's subscription flag
 func ContextSubscription(ctx context.Context) bool {
 	v := ctx.Value(ContextKeySubscription)
@@ -218,3 +266,48 @@ func ContextWebsocketConnection(ctx context.Context) Conn {
 
 	return conn
 }
+
+// ContextConnectionID returns websocket connection ID stored in a context
+func ContextConnectionID(ctx context.Context) string {
+	v := ctx.Value(ContextKeyConnectionID)
+	if v == nil {
+		return ""
+	}
+
+	res, ok := v.(string)
+	if !ok {
+		return ""
+	}
+
+	return res
+}
+
+// ContextOperationCount returns number of operations running on websocket connection, including current one
+func ContextOperationCount(ctx context.Context) int {
+	v := ctx.Value(ContextKeyOperationCount)
+	if v == nil {
+		return 0
+	}
+
+	res, ok := v.(int)
+	if !ok {
+		return 0
+	}
+
+	return res
+}
+
+// ContextPayloadInit returns websocket connection init payload stored in a context
+func ContextPayloadInit(ctx context.Context) apollows.PayloadInit {
+	v := ctx.Value(ContextKeyPayloadInit)
+	if v == nil {
+		return nil
+	}
+
+	res, ok := v.(apollows.PayloadInit)
+	if !ok {
+		return nil
+	}
+
+	return res
+}
@@ -0,0 +1,364 @@
+package wsgraphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+// FieldCost defines cost of a single field
+type FieldCost struct {
+	// Multipliers lists argument names (such as limit or first), value of the first one present (or having default
+	// value in schema) multiplies cost of the field's selections
+	Multipliers []string
+
+	// Weight is cost of the field itself
+	Weight int
+}
+
+// CostAnalysis configures static operation cost analysis, see WithCostAnalysis.
+// Cost of a field is its weight plus cost of its selections multiplied by multiplier argument value (if any),
+// cost of an operation is sum of its root fields costs. Introspection fields are free.
+type CostAnalysis struct {
+	// Fields maps field coordinates in form of "Type.field" to their costs
+	Fields map[string]FieldCost
+
+	// DefaultMultipliers are multiplier arguments of fields not listed in Fields
+	DefaultMultipliers []string
+
+	// DefaultWeight is weight of fields not listed in Fields
+	DefaultWeight int
+
+	// MaxMultiplier caps value of multiplier arguments, unless zero; negative values are rejected
+	MaxMultiplier int
+
+	// MaxCost rejects operations with greater cost before execution, unless zero
+	MaxCost int
+
+	// Extensions reports operation cost in result extensions under "cost" key
+	Extensions bool
+}
+
+func saturatingMul(a, b int) int {
+	if a != 0 && b > math.MaxInt/a {
+		return math.MaxInt
+	}
+
+	return a * b
+}
+
+type costWalker struct {
+	analysis  *CostAnalysis
+	schema    *graphql.Schema
+	variables map[string]interface{}
+	defaults  map[string]ast.Value
+	fragments map[string]*ast.FragmentDefinition
+	costs     map[string]int
+	errs      []gqlerrors.FormattedError
+}
+
+func fieldDefinitions(t graphql.Type) graphql.FieldDefinitionMap {
+	switch t := t.(type) {
+	case *graphql.Object:
+		return t.Fields()
+	case *graphql.Interface:
+		return t.Fields()
+	default:
+		return nil
+	}
+}
+
+// intValue returns integer value, resolving variables and their default values
+func (w *costWalker) intValue(value interface{}) (n int64, ok bool) {
+	switch value := value.(type) {
+	case *ast.IntValue:
+		return w.intValue(value.Value)
+	case *ast.Variable:
+		if value.Name == nil {
+			return 0, false
+		}
+
+		if v, has := w.variables[value.Name.Value]; has && v != nil {
+			return w.intValue(v)
+		}
+
+		return w.intValue(w.defaults[value.Name.Value])
+	case string:
+		n, err := strconv.ParseInt(value, 10, 64)
+
+		return n, err == nil
+	case json.Number:
+		n, err := value.Int64()
+
+		return n, err == nil
+	case float64:
+		return int64(value), value == math.Trunc(value)
+	case int:
+		return int64(value), true
+	case int32:
+		return int64(value), true
+	case int64:
+		return value, true
+	default:
+		return 0, false
+	}
+}
+
+// multiplier returns value of the first multiplier argument provided, or defined with a default value, clamped to
+// CostAnalysis.MaxMultiplier; negative values are rejected
+func (w *costWalker) multiplier(def *graphql.FieldDefinition, field *ast.Field, names []string) int {
+	for _, name := range names {
+		var value interface{}
+
+		for _, arg := range field.Arguments {
+			if arg.Name != nil && arg.Name.Value == name {
+				value = arg.Value
+
+				break
+			}
+		}
+
+		if n, ok := w.intValue(value); ok {
+			return w.clampMultiplier(field, name, n)
+		}
+
+		if def == nil {
+			continue
+		}
+
+		for _, arg := range def.Args {
+			if arg.Name() == name {
+				value = arg.DefaultValue
+
+				break
+			}
+		}
+
+		if n, ok := w.intValue(value); ok {
+			return w.clampMultiplier(field, name, n)
+		}
+	}
+
+	return 1
+}
+
+func (w *costWalker) clampMultiplier(field *ast.Field, name string, n int64) int {
+	if n < 0 {
+		err := gqlerrors.NewFormattedError(
+			fmt.Sprintf("argument %s of field %s must not be negative: %d", name, field.Name.Value, n),
+		)
+
+		if field.Loc != nil && field.Loc.Source != nil {
+			err.Locations = []location.SourceLocation{
+				location.GetLocation(field.Loc.Source, field.Loc.Start),
+			}
+		}
+
+		w.errs = append(w.errs, err)
+
+		return 0
+	}
+
+	if limit := w.analysis.MaxMultiplier; limit > 0 && n > int64(limit) {
+		return limit
+	}
+
+	if n > math.MaxInt32 {
+		return math.MaxInt32
+	}
+
+	return int(n)
+}
+
+func (w *costWalker) field(parent graphql.Type, field *ast.Field) int {
+	name := field.Name.Value
+
+	if strings.HasPrefix(name, "__") {
+		return 0
+	}
+
+	var fieldType graphql.Type
+
+	def, ok := fieldDefinitions(parent)[name]
+	if ok {
+		fieldType, _ = graphql.GetNamed(def.Type).(graphql.Type)
+	}
+
+	fc := FieldCost{
+		Weight:      w.analysis.DefaultWeight,
+		Multipliers: w.analysis.DefaultMultipliers,
+	}
+
+	if parent != nil {
+		if configured, ok := w.analysis.Fields[parent.Name()+"."+name]; ok {
+			fc = configured
+		}
+	}
+
+	children := w.selectionSet(fieldType, field.SelectionSet)
+
+	return saturatingAdd(fc.Weight, saturatingMul(w.multiplier(def, field, fc.Multipliers), children))
+}
+
+func (w *costWalker) fragment(name string) int {
+	if cost, ok := w.costs[name]; ok {
+		return cost
+	}
+
+	// guards against fragment cycles, normally rejected by validation
+	w.costs[name] = 0
+
+	def, ok := w.fragments[name]
+	if !ok || def.TypeCondition == nil || def.TypeCondition.Name == nil {
+		return 0
+	}
+
+	cost := w.selectionSet(w.schema.Type(def.TypeCondition.Name.Value), def.SelectionSet)
+
+	w.costs[name] = cost
+
+	return cost
+}
+
+func (w *costWalker) selectionSet(parent graphql.Type, set *ast.SelectionSet) (cost int) {
+	if set == nil {
+		return 0
+	}
+
+	for _, selection := range set.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			cost = saturatingAdd(cost, w.field(parent, sel))
+		case *ast.InlineFragment:
+			t := parent
+
+			if sel.TypeCondition != nil && sel.TypeCondition.Name != nil {
+				t = w.schema.Type(sel.TypeCondition.Name.Value)
+			}
+
+			cost = saturatingAdd(cost, w.selectionSet(t, sel.SelectionSet))
+		case *ast.FragmentSpread:
+			if sel.Name != nil {
+				cost = saturatingAdd(cost, w.fragment(sel.Name.Value))
+			}
+		}
+	}
+
+	return cost
+}
+
+// operationCost returns static cost of the operation to be executed, along with errors of multiplier arguments
+func (server *serverImpl) operationCost(
+	astdoc *ast.Document,
+	params *graphql.Params,
+) (int, []gqlerrors.FormattedError) {
+	w := &costWalker{
+		analysis:  server.costAnalysis,
+		schema:    &server.schema,
+		variables: params.VariableValues,
+		defaults:  make(map[string]ast.Value),
+		fragments: make(map[string]*ast.FragmentDefinition),
+		costs:     make(map[string]int),
+	}
+
+	var op *ast.OperationDefinition
+
+	for _, definition := range astdoc.Definitions {
+		switch def := definition.(type) {
+		case *ast.FragmentDefinition:
+			if def.Name != nil {
+				w.fragments[def.Name.Value] = def
+			}
+		case *ast.OperationDefinition:
+			if op == nil && (params.OperationName == "" || def.Name != nil && def.Name.Value == params.OperationName) {
+				op = def
+			}
+		}
+	}
+
+	if op == nil {
+		return 0, nil
+	}
+
+	for _, vardef := range op.VariableDefinitions {
+		if vardef.Variable != nil && vardef.Variable.Name != nil && vardef.DefaultValue != nil {
+			w.defaults[vardef.Variable.Name.Value] = vardef.DefaultValue
+		}
+	}
+
+	var root *graphql.Object
+
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		root = server.schema.MutationType()
+	case ast.OperationTypeSubscription:
+		root = server.schema.SubscriptionType()
+	default:
+		root = server.schema.QueryType()
+	}
+
+	var cost int
+
+	if root == nil {
+		cost = w.selectionSet(nil, op.SelectionSet)
+	} else {
+		cost = w.selectionSet(root, op.SelectionSet)
+	}
+
+	return cost, w.errs
+}
+
+// checkCost computes operation cost, storing it in operation context, and returns errors if it's over budget
+func (server *serverImpl) checkCost(
+	opctx mutable.Context,
+	astdoc *ast.Document,
+	params *graphql.Params,
+) []gqlerrors.FormattedError {
+	if server.costAnalysis == nil {
+		return nil
+	}
+
+	cost, errs := server.operationCost(astdoc, params)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	opctx.Set(ContextKeyCost, cost)
+
+	if server.costAnalysis.MaxCost <= 0 || cost <= server.costAnalysis.MaxCost {
+		return nil
+	}
+
+	err := gqlerrors.NewFormattedError(
+		fmt.Sprintf("query cost %d exceeds budget of %d", cost, server.costAnalysis.MaxCost),
+	)
+
+	err.Extensions = map[string]interface{}{
+		"cost":   cost,
+		"budget": server.costAnalysis.MaxCost,
+	}
+
+	return []gqlerrors.FormattedError{err}
+}
+
+// reportCost adds operation cost to result extensions, if enabled
+func (server *serverImpl) reportCost(ctx context.Context, result *graphql.Result) {
+	if server.costAnalysis == nil || !server.costAnalysis.Extensions || result == nil {
+		return
+	}
+
+	if result.Extensions == nil {
+		result.Extensions = make(map[string]interface{})
+	}
+
+	result.Extensions["cost"] = ContextCost(ctx)
+}
@@ -0,0 +1,208 @@
+package wsgraphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewCostSchema(t *testing.T) graphql.Schema {
+	item := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Item",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.Int,
+			},
+		},
+	})
+
+	item.AddFieldConfig("children", &graphql.Field{
+		Type: graphql.NewList(item),
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{
+				Type: graphql.Int,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"items": &graphql.Field{
+					Type: graphql.NewList(item),
+					Args: graphql.FieldConfigArgument{
+						"limit": &graphql.ArgumentConfig{
+							Type:         graphql.Int,
+							DefaultValue: 10,
+						},
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return []interface{}{map[string]interface{}{"id": 1}}, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+func TestOperationCost(t *testing.T) {
+	server := &serverImpl{
+		schema: testNewCostSchema(t),
+		serverConfig: serverConfig{
+			costAnalysis: &CostAnalysis{
+				Fields: map[string]FieldCost{
+					"QueryRoot.items": {
+						Weight:      2,
+						Multipliers: []string{"limit"},
+					},
+					"Item.id": {},
+				},
+				DefaultWeight:      1,
+				DefaultMultipliers: []string{"first"},
+				MaxMultiplier:      100,
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		cost      int
+		errs      []string
+	}{
+		{
+			name:  "plain",
+			query: `query { items { id } }`,
+			cost:  2,
+		},
+		{
+			name:  "multipliers",
+			query: `query { items(limit: 10) { id children(first: 5) { id __typename } } }`,
+			cost:  2 + 10*(1+5*0),
+		},
+		{
+			name:  "nested multipliers",
+			query: `query { items(limit: 10) { children(first: 5) { children(first: 3) { id } } } }`,
+			cost:  2 + 10*(1+5*(1+3*0)),
+		},
+		{
+			name: "variables and fragments",
+			query: `
+				query ($n: Int) { items(limit: $n) { ...F ... on Item { children { id } } } }
+				fragment F on Item { children(first: 2) { id } }
+			`,
+			variables: map[string]interface{}{"n": float64(4)},
+			cost:      2 + 4*(1+1),
+		},
+		{
+			name:  "schema default",
+			query: `query { items { children { id } } }`,
+			cost:  2 + 10*1,
+		},
+		{
+			name:  "variable default",
+			query: `query ($n: Int = 3) { items(limit: $n) { children { id } } }`,
+			cost:  2 + 3*1,
+		},
+		{
+			name:      "clamped",
+			query:     `query ($n: Int) { items(limit: $n) { children { id } } }`,
+			variables: map[string]interface{}{"n": float64(1 << 40)},
+			cost:      2 + 100*1,
+		},
+		{
+			name:  "negative",
+			query: `query { items(limit: -1) { children { id } } }`,
+			cost:  2,
+			errs:  []string{"argument limit of field items must not be negative: -1"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			astdoc, err := parser.Parse(parser.ParseParams{
+				Source: tc.query,
+			})
+
+			assert.NoError(t, err)
+
+			cost, errs := server.operationCost(astdoc, &graphql.Params{
+				VariableValues: tc.variables,
+			})
+
+			var msgs []string
+
+			for _, err := range errs {
+				msgs = append(msgs, err.Message)
+
+				assert.NotEmpty(t, err.Locations)
+			}
+
+			assert.Equal(t, tc.cost, cost)
+			assert.Equal(t, tc.errs, msgs)
+		})
+	}
+}
+
+func TestNewServerCostAnalysis(t *testing.T) {
+	server, err := NewServer(testNewCostSchema(t), WithCostAnalysis(CostAnalysis{
+		DefaultWeight:      1,
+		DefaultMultipliers: []string{"limit", "first"},
+		MaxCost:            20,
+		Extensions:         true,
+	}))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	_, pd := testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/json",
+		`{"query":"query { items(limit: 5) { id } }"}`,
+	)
+
+	assert.Empty(t, pd.Errors)
+	assert.NotNil(t, pd.Data["items"])
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"query":"query { items(limit: 5) { id } }"}`))
+
+	assert.NoError(t, err)
+
+	var res graphql.Result
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	assert.NoError(t, resp.Body.Close())
+	assert.EqualValues(t, 6, res.Extensions["cost"])
+
+	_, pd = testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/json",
+		`{"query":"query { items(limit: 5) { id children(first: 5) { id } } }"}`,
+	)
+
+	assert.Nil(t, pd.Data)
+
+	if assert.Len(t, pd.Errors, 1) {
+		assert.Equal(t, "query cost 36 exceeds budget of 20", pd.Errors[0].Message)
+		assert.EqualValues(t, 36, pd.Errors[0].Extensions["cost"])
+	}
+}
@@ -0,0 +1,181 @@
+package wsgraphql
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+// queryLimits restricts shape of operation documents, zero value means no limit
+type queryLimits struct {
+	depth           int
+	aliases         int
+	rootFields      int
+	fragmentSpreads int
+}
+
+func (limits queryLimits) enabled() bool {
+	return limits.depth > 0 || limits.aliases > 0 || limits.rootFields > 0 || limits.fragmentSpreads > 0
+}
+
+// selectionStats describes selection set with fragments expanded
+type selectionStats struct {
+	depth   int
+	fields  int
+	aliases int
+	spreads int
+}
+
+// saturatingAdd avoids overflow on documents reusing fragments exponentially
+func saturatingAdd(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+
+	return a + b
+}
+
+func (stats *selectionStats) merge(other selectionStats) {
+	if other.depth > stats.depth {
+		stats.depth = other.depth
+	}
+
+	stats.fields = saturatingAdd(stats.fields, other.fields)
+	stats.aliases = saturatingAdd(stats.aliases, other.aliases)
+	stats.spreads = saturatingAdd(stats.spreads, other.spreads)
+}
+
+type limitsWalker struct {
+	fragments map[string]*ast.FragmentDefinition
+	stats     map[string]*selectionStats
+}
+
+func (w *limitsWalker) fragment(name string) selectionStats {
+	if stats, ok := w.stats[name]; ok {
+		return *stats
+	}
+
+	// guards against fragment cycles, normally rejected by validation
+	w.stats[name] = &selectionStats{}
+
+	def, ok := w.fragments[name]
+	if !ok {
+		return selectionStats{}
+	}
+
+	stats := w.selectionSet(def.SelectionSet)
+
+	w.stats[name] = &stats
+
+	return stats
+}
+
+func (w *limitsWalker) selectionSet(set *ast.SelectionSet) (res selectionStats) {
+	if set == nil {
+		return
+	}
+
+	for _, selection := range set.Selections {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			child := w.selectionSet(sel.SelectionSet)
+
+			child.depth++
+			child.fields = 1
+
+			if sel.Alias != nil && sel.Alias.Value != "" {
+				child.aliases = saturatingAdd(child.aliases, 1)
+			}
+
+			res.merge(child)
+		case *ast.InlineFragment:
+			res.merge(w.selectionSet(sel.SelectionSet))
+		case *ast.FragmentSpread:
+			if sel.Name == nil {
+				continue
+			}
+
+			child := w.fragment(sel.Name.Value)
+
+			child.spreads = saturatingAdd(child.spreads, 1)
+
+			res.merge(child)
+		}
+	}
+
+	return
+}
+
+func queryLimitError(op *ast.OperationDefinition, format string, args ...interface{}) gqlerrors.FormattedError {
+	err := gqlerrors.NewFormattedError(fmt.Sprintf(format, args...))
+
+	if op.Loc != nil && op.Loc.Source != nil {
+		err.Locations = []location.SourceLocation{
+			location.GetLocation(op.Loc.Source, op.Loc.Start),
+		}
+	}
+
+	return err
+}
+
+// check returns errors for limits exceeded by the operation
+func (limits queryLimits) check(op *ast.OperationDefinition, stats selectionStats) (errs []gqlerrors.FormattedError) {
+	checks := []struct {
+		name  string
+		value int
+		limit int
+	}{
+		{"depth", stats.depth, limits.depth},
+		{"aliases", stats.aliases, limits.aliases},
+		{"root fields", stats.fields, limits.rootFields},
+		{"fragment spreads", stats.spreads, limits.fragmentSpreads},
+	}
+
+	for _, c := range checks {
+		if c.limit > 0 && c.value > c.limit {
+			errs = append(errs, queryLimitError(op, "%s limit of %d exceeded: %d", c.name, c.limit, c.value))
+		}
+	}
+
+	return errs
+}
+
+// checkQueryLimits evaluates operations of the document to be executed against configured limits
+func (server *serverImpl) checkQueryLimits(
+	astdoc *ast.Document,
+	operationName string,
+) (errs []gqlerrors.FormattedError) {
+	limits := server.queryLimits
+	if !limits.enabled() {
+		return nil
+	}
+
+	w := &limitsWalker{
+		fragments: make(map[string]*ast.FragmentDefinition),
+		stats:     make(map[string]*selectionStats),
+	}
+
+	var ops []*ast.OperationDefinition
+
+	for _, definition := range astdoc.Definitions {
+		switch def := definition.(type) {
+		case *ast.FragmentDefinition:
+			if def.Name != nil {
+				w.fragments[def.Name.Value] = def
+			}
+		case *ast.OperationDefinition:
+			if operationName == "" || def.Name != nil && def.Name.Value == operationName {
+				ops = append(ops, def)
+			}
+		}
+	}
+
+	for _, op := range ops {
+		errs = append(errs, limits.check(op, w.selectionSet(op.SelectionSet))...)
+	}
+
+	return errs
+}
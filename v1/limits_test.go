@@ -0,0 +1,163 @@
+package wsgraphql
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckQueryLimits(t *testing.T) {
+	astdoc, err := parser.Parse(parser.ParseParams{
+		Source: `
+			query Foo {
+				a: foo { bar { ...Baz } }
+				b: foo { ... on Foo { bar { id } } }
+			}
+
+			fragment Baz on Bar { baz { id } other: id }
+
+			query Other { foo }
+		`,
+	})
+
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		limits queryLimits
+		op     string
+		errs   []string
+	}{
+		{
+			name:   "within limits",
+			limits: queryLimits{depth: 4, aliases: 3, rootFields: 2, fragmentSpreads: 1},
+			op:     "Foo",
+		},
+		{
+			name:   "exceeding limits",
+			limits: queryLimits{depth: 3, aliases: 2, rootFields: 1},
+			op:     "Foo",
+			errs: []string{
+				"depth limit of 3 exceeded: 4",
+				"aliases limit of 2 exceeded: 3",
+				"root fields limit of 1 exceeded: 2",
+			},
+		},
+		{
+			name:   "selected operation",
+			limits: queryLimits{depth: 1, rootFields: 1},
+			op:     "Other",
+		},
+		{
+			name:   "all operations",
+			limits: queryLimits{rootFields: 1},
+			errs: []string{
+				"root fields limit of 1 exceeded: 2",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &serverImpl{
+				serverConfig: serverConfig{
+					queryLimits: tc.limits,
+				},
+			}
+
+			var msgs []string
+
+			for _, err := range server.checkQueryLimits(astdoc, tc.op) {
+				msgs = append(msgs, err.Message)
+
+				assert.NotEmpty(t, err.Locations)
+			}
+
+			assert.Equal(t, tc.errs, msgs)
+		})
+	}
+}
+
+func TestCheckQueryLimitsFragmentReuse(t *testing.T) {
+	astdoc, err := parser.Parse(parser.ParseParams{
+		Source: `
+			query { ...A }
+			fragment A on Query { ...B ...B }
+			fragment B on Query { ...C ...C }
+			fragment C on Query { x: foo }
+		`,
+	})
+
+	assert.NoError(t, err)
+
+	server := &serverImpl{
+		serverConfig: serverConfig{
+			queryLimits: queryLimits{aliases: 3, fragmentSpreads: 6},
+		},
+	}
+
+	var msgs []string
+
+	for _, err := range server.checkQueryLimits(astdoc, "") {
+		msgs = append(msgs, err.Message)
+	}
+
+	assert.Equal(t, []string{
+		"aliases limit of 3 exceeded: 4",
+		"fragment spreads limit of 6 exceeded: 7",
+	}, msgs)
+}
+
+func TestNewServerQueryLimits(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithMaxAliases(1))
+
+	defer srv.Close()
+
+	resp, pd := testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/json",
+		`{"query":"query { a: getFoo b: getFoo }"}`,
+	)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, pd.Data)
+
+	if assert.Len(t, pd.Errors, 1) {
+		assert.Equal(t, "aliases limit of 1 exceeded: 2", pd.Errors[0].Message)
+	}
+
+	_, pd = testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/json",
+		`{"query":"query { a: getFoo getFoo }"}`,
+	)
+
+	assert.Empty(t, pd.Errors)
+	assert.EqualValues(t, 123, pd.Data["a"])
+}
+
+func TestNewServerQueryLimitsBeforeValidation(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithMaxAliases(1))
+
+	defer srv.Close()
+
+	_, pd := testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/json",
+		`{"query":"query { a: unknown b: unknown }"}`,
+	)
+
+	if assert.Len(t, pd.Errors, 1) {
+		assert.Equal(t, "aliases limit of 1 exceeded: 2", pd.Errors[0].Message)
+	}
+}
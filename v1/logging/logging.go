@@ -0,0 +1,247 @@
+// Package logging provides log/slog based logging of connection and operation lifecycle events, keeping logger
+// enriched with connection and operation attributes in the context
+package logging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+)
+
+// Attribute keys added to the logger
+const (
+	KeyRemoteAddr    = "remote_addr"
+	KeyProtocol      = "protocol"
+	KeyOperationID   = "operation_id"
+	KeyOperationName = "operation_name"
+	KeyCloseCode     = "close_code"
+	KeyError         = "error"
+)
+
+// ProtocolHTTP is protocol attribute value of plain HTTP and SSE requests
+const ProtocolHTTP = "http"
+
+// Logging logs lifecycle events and stores enriched logger in request and operation contexts, see ContextLogger
+type Logging interface {
+	// Callbacks returns callbacks logging lifecycle events, calling provided ones
+	Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks
+
+	// Upgrader returns upgrader logging close codes of websocket connections upgraded by provided one, or by standard
+	// library upgrader supporting both graphql-ws and graphql-transport-ws if nil
+	Upgrader(next wsgraphql.Upgrader) wsgraphql.Upgrader
+}
+
+type loggingConfig struct {
+	lifecycleLevel slog.Level
+	errorLevel     slog.Level
+}
+
+// Option to configure Logging
+type Option func(config *loggingConfig) error
+
+// WithLifecycleLevel option sets level of connection init, operation start and completion and disconnection events,
+// slog.LevelDebug by default
+func WithLifecycleLevel(level slog.Level) Option {
+	return func(config *loggingConfig) error {
+		config.lifecycleLevel = level
+
+		return nil
+	}
+}
+
+// WithErrorLevel option sets level of failed operations and connections closed with an error, slog.LevelWarn by
+// default
+func WithErrorLevel(level slog.Level) Option {
+	return func(config *loggingConfig) error {
+		config.errorLevel = level
+
+		return nil
+	}
+}
+
+type contextKeyLoggerT struct{}
+
+var contextKeyLogger = contextKeyLoggerT{}
+
+// ContextLogger returns logger stored in a context, enriched with attributes of connection and operation, or
+// default logger if there is none
+func ContextLogger(ctx context.Context) *slog.Logger {
+	logger, ok := ctx.Value(contextKeyLogger).(*slog.Logger)
+	if !ok {
+		return slog.Default()
+	}
+
+	return logger
+}
+
+type logging struct {
+	logger *slog.Logger
+	loggingConfig
+}
+
+// New returns new Logging instance, deriving loggers from provided one
+func New(logger *slog.Logger, options ...Option) (Logging, error) {
+	config := loggingConfig{
+		lifecycleLevel: slog.LevelDebug,
+		errorLevel:     slog.LevelWarn,
+	}
+
+	for _, o := range options {
+		err := o(&config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &logging{
+		logger:        logger,
+		loggingConfig: config,
+	}, nil
+}
+
+func protocol(ctx context.Context) string {
+	if conn := wsgraphql.ContextWebsocketConnection(ctx); conn != nil {
+		return conn.Subprotocol()
+	}
+
+	return ProtocolHTTP
+}
+
+// disconnect logs connection end with its close code or error
+func (l *logging) disconnect(reqctx mutable.Context, origerr error) {
+	logger := ContextLogger(reqctx)
+
+	var awerr apollows.Error
+
+	switch {
+	case errors.As(origerr, &awerr):
+		logger.LogAttrs(reqctx, l.errorLevel, "disconnect",
+			slog.Int(KeyCloseCode, int(awerr.EventMessageType())),
+			slog.String(KeyError, awerr.Error()),
+		)
+	case origerr != nil:
+		logger.LogAttrs(reqctx, l.errorLevel, "disconnect", slog.String(KeyError, origerr.Error()))
+	default:
+		logger.LogAttrs(reqctx, l.lifecycleLevel, "disconnect")
+	}
+}
+
+func (l *logging) Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks {
+	res := next
+
+	res.OnRequest = func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter) error {
+		reqctx.Set(contextKeyLogger, l.logger.With(slog.String(KeyRemoteAddr, r.RemoteAddr)))
+
+		if next.OnRequest != nil {
+			return next.OnRequest(reqctx, r, w)
+		}
+
+		return nil
+	}
+
+	res.OnConnect = func(reqctx mutable.Context, init apollows.PayloadInit) error {
+		logger := ContextLogger(reqctx).With(slog.String(KeyProtocol, protocol(reqctx)))
+
+		reqctx.Set(contextKeyLogger, logger)
+
+		if next.OnConnect != nil {
+			if err := next.OnConnect(reqctx, init); err != nil {
+				logger.LogAttrs(reqctx, l.errorLevel, "init rejected", slog.String(KeyError, err.Error()))
+
+				return err
+			}
+		}
+
+		logger.LogAttrs(reqctx, l.lifecycleLevel, "init")
+
+		return nil
+	}
+
+	res.OnDisconnect = func(reqctx mutable.Context, origerr error) error {
+		if next.OnDisconnect != nil {
+			origerr = next.OnDisconnect(reqctx, origerr)
+		}
+
+		l.disconnect(reqctx, origerr)
+
+		return origerr
+	}
+
+	res.OnOperation = func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+		logger := ContextLogger(opctx).With(
+			slog.String(KeyOperationID, wsgraphql.ContextOperationID(opctx)),
+			slog.String(KeyOperationName, payload.OperationName),
+		)
+
+		opctx.Set(contextKeyLogger, logger)
+
+		logger.LogAttrs(opctx, l.lifecycleLevel, "subscribe")
+
+		if next.OnOperation != nil {
+			return next.OnOperation(opctx, payload)
+		}
+
+		return nil
+	}
+
+	res.OnOperationDone = func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error {
+		if next.OnOperationDone != nil {
+			origerr = next.OnOperationDone(opctx, payload, origerr)
+		}
+
+		logger := ContextLogger(opctx)
+
+		if origerr != nil {
+			logger.LogAttrs(opctx, l.errorLevel, "operation failed", slog.String(KeyError, origerr.Error()))
+		} else {
+			logger.LogAttrs(opctx, l.lifecycleLevel, "complete")
+		}
+
+		return origerr
+	}
+
+	return res
+}
+
+func (l *logging) Upgrader(next wsgraphql.Upgrader) wsgraphql.Upgrader {
+	return wsgraphql.WrapUpgrader(next, func(r *http.Request, c wsgraphql.Conn) wsgraphql.Conn {
+		return &conn{
+			Conn: c,
+			l:    l,
+			ctx:  r.Context(),
+			logger: l.logger.With(
+				slog.String(KeyRemoteAddr, r.RemoteAddr),
+				slog.String(KeyProtocol, c.Subprotocol()),
+			),
+		}
+	})
+}
+
+type conn struct {
+	wsgraphql.Conn
+	l      *logging
+	ctx    context.Context
+	logger *slog.Logger
+	closed int32
+}
+
+// Close logs close code of the connection closed by the server, normal closures are logged at lifecycle level
+func (c *conn) Close(code int, message string) error {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		level := c.l.errorLevel
+
+		if code == int(apollows.EventCloseNormal) {
+			level = c.l.lifecycleLevel
+		}
+
+		c.logger.LogAttrs(c.ctx, level, "close", slog.Int(KeyCloseCode, code), slog.String(KeyError, message))
+	}
+
+	return c.Conn.Close(code, message)
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testBuffer struct {
+	buf bytes.Buffer
+	m   sync.Mutex
+}
+
+func (b *testBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *testBuffer) records(t *testing.T) (res []map[string]interface{}) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var rec map[string]interface{}
+
+		assert.NoError(t, json.Unmarshal([]byte(line), &rec))
+
+		res = append(res, rec)
+	}
+
+	return res
+}
+
+func TestLogging(t *testing.T) {
+	var buf testBuffer
+
+	loggers := make(chan *slog.Logger, 1)
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						loggers <- ContextLogger(p.Context)
+
+						return 1, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	logging, err := New(
+		slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		WithLifecycleLevel(slog.LevelInfo),
+		WithErrorLevel(slog.LevelError),
+	)
+
+	assert.NoError(t, err)
+
+	server, err := wsgraphql.NewServer(
+		schema,
+		wsgraphql.WithCallbacks(logging.Callbacks(wsgraphql.Callbacks{})),
+		wsgraphql.WithUpgrader(logging.Upgrader(nil)),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	for _, msg := range []apollows.Message{
+		{
+			Type:    apollows.OperationConnectionInit,
+			Payload: apollows.Data{},
+		},
+		{
+			ID:   "1",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query:         `query Foo { foo }`,
+					OperationName: "Foo",
+				},
+			},
+		},
+		{
+			ID:   "2",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `query { bar }`,
+				},
+			},
+		},
+	} {
+		assert.NoError(t, conn.WriteJSON(msg))
+	}
+
+	var msg apollows.Message
+
+	// complete of the first operation and error of the second one
+	for i := 0; i < 2; {
+		assert.NoError(t, conn.ReadJSON(&msg))
+
+		if msg.Type != apollows.OperationNext {
+			i++
+		}
+	}
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type:    apollows.OperationConnectionInit,
+		Payload: apollows.Data{},
+	}))
+
+	for err == nil {
+		err = conn.ReadJSON(&msg)
+	}
+
+	_ = conn.Close()
+
+	assert.NotNil(t, <-loggers)
+
+	for i := 0; i < 100 && len(buf.records(t)) < 7; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	type event struct {
+		msg, level, id string
+	}
+
+	var events []event
+
+	for _, rec := range buf.records(t) {
+		assert.NotEmpty(t, rec[KeyRemoteAddr])
+
+		if rec["msg"] != "init" && rec["msg"] != "disconnect" {
+			assert.Equal(t, "graphql-transport-ws", rec[KeyProtocol])
+		}
+
+		id, _ := rec[KeyOperationID].(string)
+
+		events = append(events, event{rec["msg"].(string), rec["level"].(string), id})
+	}
+
+	assert.Contains(t, events, event{"init", "INFO", ""})
+	assert.Contains(t, events, event{"subscribe", "INFO", "1"})
+	assert.Contains(t, events, event{"complete", "INFO", "1"})
+	assert.Contains(t, events, event{"subscribe", "INFO", "2"})
+	assert.Contains(t, events, event{"operation failed", "ERROR", "2"})
+	assert.Contains(t, events, event{"close", "ERROR", ""})
+
+	for _, rec := range buf.records(t) {
+		if rec["msg"] == "close" {
+			assert.EqualValues(t, apollows.EventTooManyInitializationRequests, rec[KeyCloseCode])
+		}
+	}
+}
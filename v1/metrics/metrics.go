@@ -0,0 +1,312 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/bitquery/wsgraphql/v1/stdws"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// DefaultDurationBuckets are operation duration histogram buckets, in seconds
+var DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// ProtocolHTTP is protocol label value of plain HTTP and SSE requests
+const ProtocolHTTP = "http"
+
+// Instrumentation records server metrics: connection and operation ones via Callbacks, websocket message, byte,
+// keepalive and close code ones via Upgrader, so both should be used to collect all of them
+type Instrumentation interface {
+	// Callbacks returns callbacks recording metrics, calling provided ones
+	Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks
+
+	// Upgrader returns upgrader recording metrics of connections upgraded by provided one, or by standard library
+	// upgrader supporting both graphql-ws and graphql-transport-ws if nil
+	Upgrader(next wsgraphql.Upgrader) wsgraphql.Upgrader
+}
+
+type (
+	contextKeyConnectedT      struct{}
+	contextKeyOperationStartT struct{}
+)
+
+var (
+	contextKeyConnected      = contextKeyConnectedT{}
+	contextKeyOperationStart = contextKeyOperationStartT{}
+)
+
+type instrumentation struct {
+	connections       Gauge
+	operationsStarted Counter
+	operationsDone    Counter
+	operationsFailed  Counter
+	operationDuration Histogram
+	messagesReceived  Counter
+	messagesSent      Counter
+	bytesSent         Counter
+	keepalives        Counter
+	closeCodes        Counter
+}
+
+// New returns Instrumentation registering its metrics with provided registry
+func New(registry Registry) Instrumentation {
+	return &instrumentation{
+		connections: registry.Gauge(
+			"wsgraphql_connections_active", "Number of active connections.", "protocol",
+		),
+		operationsStarted: registry.Counter(
+			"wsgraphql_operations_started_total", "Number of started operations.", "protocol",
+		),
+		operationsDone: registry.Counter(
+			"wsgraphql_operations_completed_total", "Number of successfully completed operations.", "protocol", "type",
+		),
+		operationsFailed: registry.Counter(
+			"wsgraphql_operations_failed_total", "Number of failed operations.", "protocol", "type",
+		),
+		operationDuration: registry.Histogram(
+			"wsgraphql_operation_duration_seconds", "Duration of operations.", DefaultDurationBuckets, "protocol", "type",
+		),
+		messagesReceived: registry.Counter(
+			"wsgraphql_messages_received_total", "Number of received websocket messages.", "protocol", "type",
+		),
+		messagesSent: registry.Counter(
+			"wsgraphql_messages_sent_total", "Number of sent websocket messages.", "protocol", "type",
+		),
+		bytesSent: registry.Counter(
+			"wsgraphql_bytes_sent_total", "Number of bytes written to websocket connections.", "protocol",
+		),
+		keepalives: registry.Counter(
+			"wsgraphql_keepalive_frames_total", "Number of keepalive, ping and pong messages.", "protocol", "type",
+		),
+		closeCodes: registry.Counter(
+			"wsgraphql_close_codes_total", "Number of websocket connections closed by code.", "protocol", "code",
+		),
+	}
+}
+
+func protocol(ctx mutable.Context) string {
+	if conn := wsgraphql.ContextWebsocketConnection(ctx); conn != nil {
+		return conn.Subprotocol()
+	}
+
+	return ProtocolHTTP
+}
+
+// operationType returns type of the operation executed, if document was parsed
+func operationType(opctx mutable.Context, payload *apollows.PayloadOperation) string {
+	doc := wsgraphql.ContextAST(opctx)
+	if doc == nil {
+		return "unknown"
+	}
+
+	for _, definition := range doc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if payload == nil || payload.OperationName == "" || op.Name != nil && op.Name.Value == payload.OperationName {
+			return op.Operation
+		}
+	}
+
+	return "unknown"
+}
+
+func (inst *instrumentation) Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks {
+	res := next
+
+	res.OnConnect = func(reqctx mutable.Context, init apollows.PayloadInit) error {
+		if next.OnConnect != nil {
+			if err := next.OnConnect(reqctx, init); err != nil {
+				return err
+			}
+		}
+
+		if reqctx.Value(contextKeyConnected) == nil {
+			proto := protocol(reqctx)
+
+			reqctx.Set(contextKeyConnected, proto)
+			inst.connections.Add(1, proto)
+		}
+
+		return nil
+	}
+
+	res.OnDisconnect = func(reqctx mutable.Context, origerr error) error {
+		if proto, ok := reqctx.Value(contextKeyConnected).(string); ok {
+			inst.connections.Add(-1, proto)
+		}
+
+		if next.OnDisconnect != nil {
+			return next.OnDisconnect(reqctx, origerr)
+		}
+
+		return origerr
+	}
+
+	res.OnOperation = func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+		opctx.Set(contextKeyOperationStart, time.Now())
+		inst.operationsStarted.Add(1, protocol(opctx))
+
+		if next.OnOperation != nil {
+			return next.OnOperation(opctx, payload)
+		}
+
+		return nil
+	}
+
+	res.OnOperationDone = func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error {
+		if next.OnOperationDone != nil {
+			origerr = next.OnOperationDone(opctx, payload, origerr)
+		}
+
+		start, ok := opctx.Value(contextKeyOperationStart).(time.Time)
+		if !ok {
+			return origerr
+		}
+
+		proto, optype := protocol(opctx), operationType(opctx, payload)
+
+		if origerr != nil {
+			inst.operationsFailed.Add(1, proto, optype)
+		} else {
+			inst.operationsDone.Add(1, proto, optype)
+		}
+
+		inst.operationDuration.Observe(time.Since(start).Seconds(), proto, optype)
+
+		return origerr
+	}
+
+	return res
+}
+
+func (inst *instrumentation) Upgrader(next wsgraphql.Upgrader) wsgraphql.Upgrader {
+	return wsgraphql.WrapUpgrader(next, func(r *http.Request, c wsgraphql.Conn) wsgraphql.Conn {
+		return &conn{
+			Conn:     c,
+			inst:     inst,
+			protocol: c.Subprotocol(),
+		}
+	})
+}
+
+type conn struct {
+	wsgraphql.Conn
+	inst     *instrumentation
+	protocol string
+	closed   int32
+}
+
+// messageTypeUnknown is type label value of messages of types not defined by supported subprotocols
+const messageTypeUnknown = "unknown"
+
+// knownMessageTypes keeps type label cardinality bounded, as received message types are chosen by clients
+var knownMessageTypes = map[apollows.Operation]struct{}{
+	apollows.OperationConnectionInit:  {},
+	apollows.OperationStart:           {},
+	apollows.OperationSubscribe:       {},
+	apollows.OperationTerminate:       {},
+	apollows.OperationConnectionError: {},
+	apollows.OperationConnectionAck:   {},
+	apollows.OperationData:            {},
+	apollows.OperationNext:            {},
+	apollows.OperationError:           {},
+	apollows.OperationStop:            {},
+	apollows.OperationComplete:        {},
+	apollows.OperationKeepAlive:       {},
+	apollows.OperationPing:            {},
+	apollows.OperationPong:            {},
+}
+
+func messageType(t apollows.Operation) string {
+	if _, ok := knownMessageTypes[t]; !ok {
+		return messageTypeUnknown
+	}
+
+	return string(t)
+}
+
+// measuredJSON records size of its encoding, so message is encoded once by the underlying connection
+type measuredJSON struct {
+	v    interface{}
+	size *int
+}
+
+func (m measuredJSON) MarshalJSON() ([]byte, error) {
+	bs, err := json.Marshal(m.v)
+
+	*m.size = len(bs)
+
+	return bs, err
+}
+
+func isKeepalive(t apollows.Operation) bool {
+	return t == apollows.OperationKeepAlive || t == apollows.OperationPing || t == apollows.OperationPong
+}
+
+func (c *conn) recordClose(code int) {
+	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		c.inst.closeCodes.Add(1, c.protocol, strconv.Itoa(code))
+	}
+}
+
+func (c *conn) ReadJSON(v interface{}) error {
+	err := c.Conn.ReadJSON(v)
+	if err != nil {
+		// close initiated by the client is only recognized for standard library connections
+		var cerr *stdws.CloseError
+
+		if errors.As(err, &cerr) {
+			c.recordClose(cerr.Code)
+		}
+
+		return err
+	}
+
+	if msg, ok := v.(*apollows.Message); ok {
+		c.inst.messagesReceived.Add(1, c.protocol, messageType(msg.Type))
+
+		if isKeepalive(msg.Type) {
+			c.inst.keepalives.Add(1, c.protocol, string(msg.Type))
+		}
+	}
+
+	return nil
+}
+
+func (c *conn) WriteJSON(v interface{}) error {
+	var size int
+
+	err := c.Conn.WriteJSON(measuredJSON{v: v, size: &size})
+	if err != nil {
+		return err
+	}
+
+	c.inst.bytesSent.Add(float64(size), c.protocol)
+
+	if msg, ok := v.(*apollows.Message); ok {
+		c.inst.messagesSent.Add(1, c.protocol, messageType(msg.Type))
+
+		if isKeepalive(msg.Type) {
+			c.inst.keepalives.Add(1, c.protocol, string(msg.Type))
+		}
+	}
+
+	return nil
+}
+
+// Close records close code, unless connection was already closed
+func (c *conn) Close(code int, message string) error {
+	c.recordClose(code)
+
+	return c.Conn.Close(code, message)
+}
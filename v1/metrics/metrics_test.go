@@ -0,0 +1,227 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewSchema(t *testing.T) graphql.Schema {
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return 1, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	return schema
+}
+
+func testScrape(t *testing.T, reg ExpositionRegistry) string {
+	rec := httptest.NewRecorder()
+
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	bs, err := io.ReadAll(rec.Body)
+
+	assert.NoError(t, err)
+
+	return string(bs)
+}
+
+func TestInstrumentation(t *testing.T) {
+	reg := NewRegistry()
+	inst := New(reg)
+
+	server, err := wsgraphql.NewServer(
+		testNewSchema(t),
+		wsgraphql.WithCallbacks(inst.Callbacks(wsgraphql.Callbacks{})),
+		wsgraphql.WithUpgrader(inst.Upgrader(nil)),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"query":"query { foo }"}`))
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	for _, msg := range []apollows.Message{
+		{
+			Type:    apollows.OperationConnectionInit,
+			Payload: apollows.Data{},
+		},
+		{
+			Type: apollows.OperationPing,
+		},
+		{
+			ID:   "1",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `query { foo }`,
+				},
+			},
+		},
+		{
+			ID:   "2",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `query { bar }`,
+				},
+			},
+		},
+	} {
+		assert.NoError(t, conn.WriteJSON(msg))
+	}
+
+	var msg apollows.Message
+
+	// ack, pong, next, complete, error
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, conn.ReadJSON(&msg))
+	}
+
+	gtws := `protocol="graphql-transport-ws"`
+
+	assert.Contains(t, testScrape(t, reg), `wsgraphql_connections_active{`+gtws+`} 1`)
+
+	assert.NoError(t, conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4000, "")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+	defer cancel()
+
+	for ctx.Err() == nil && !strings.Contains(testScrape(t, reg), `wsgraphql_connections_active{`+gtws+`} 0`) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	_ = conn.Close()
+
+	out := testScrape(t, reg)
+
+	for _, line := range []string{
+		`wsgraphql_connections_active{` + gtws + `} 0`,
+		`wsgraphql_connections_active{protocol="http"} 0`,
+		`wsgraphql_operations_started_total{` + gtws + `} 2`,
+		`wsgraphql_operations_started_total{protocol="http"} 1`,
+		`wsgraphql_operations_completed_total{` + gtws + `,type="query"} 1`,
+		`wsgraphql_operations_completed_total{protocol="http",type="query"} 1`,
+		`wsgraphql_operations_failed_total{` + gtws + `,type="unknown"} 1`,
+		`wsgraphql_operation_duration_seconds_count{` + gtws + `,type="query"} 1`,
+		`wsgraphql_messages_received_total{` + gtws + `,type="subscribe"} 2`,
+		`wsgraphql_messages_sent_total{` + gtws + `,type="next"} 1`,
+		`wsgraphql_keepalive_frames_total{` + gtws + `,type="ping"} 1`,
+		`wsgraphql_keepalive_frames_total{` + gtws + `,type="pong"} 1`,
+		`wsgraphql_close_codes_total{` + gtws + `,code="4000"} 1`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+
+	assert.Contains(t, out, `wsgraphql_bytes_sent_total{`+gtws+`} `)
+}
+
+// testConn decodes reads from and records encoding of writes to buf
+type testConn struct {
+	buf    bytes.Buffer
+	writes int
+}
+
+func (c *testConn) ReadJSON(v interface{}) error {
+	return json.NewDecoder(&c.buf).Decode(v)
+}
+
+func (c *testConn) WriteJSON(v interface{}) error {
+	c.writes++
+
+	return json.NewEncoder(&c.buf).Encode(v)
+}
+
+func (c *testConn) Close(code int, message string) error {
+	return nil
+}
+
+func (c *testConn) Subprotocol() string {
+	return apollows.WebsocketSubprotocolGraphqlTransportWS.String()
+}
+
+type testUpgrader struct {
+	conn *testConn
+}
+
+func (u testUpgrader) Upgrade(w http.ResponseWriter, r *http.Request, header http.Header) (wsgraphql.Conn, error) {
+	return u.conn, nil
+}
+
+func TestInstrumentationMessages(t *testing.T) {
+	reg := NewRegistry()
+	tc := &testConn{}
+
+	conn, err := New(reg).Upgrader(testUpgrader{conn: tc}).Upgrade(nil, nil, nil)
+
+	assert.NoError(t, err)
+
+	msg := &apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationComplete,
+	}
+
+	assert.NoError(t, conn.WriteJSON(msg))
+	assert.Equal(t, 1, tc.writes)
+
+	size := tc.buf.Len() - 1
+
+	tc.buf.Reset()
+	tc.buf.WriteString(`{"type":"bogus"}`)
+
+	var read apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&read))
+
+	out := testScrape(t, reg)
+	gtws := `protocol="graphql-transport-ws"`
+
+	for _, line := range []string{
+		`wsgraphql_messages_sent_total{` + gtws + `,type="complete"} 1`,
+		`wsgraphql_messages_received_total{` + gtws + `,type="unknown"} 1`,
+		`wsgraphql_bytes_sent_total{` + gtws + `} ` + strconv.Itoa(size),
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+
+	assert.NotContains(t, out, "bogus")
+}
@@ -0,0 +1,260 @@
+// Package metrics provides server instrumentation exposing counters, gauges and histograms through registry-agnostic
+// interface, along with in-memory registry serving Prometheus text exposition format
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Counter is monotonically increasing metric
+type Counter interface {
+	Add(value float64, labelValues ...string)
+}
+
+// Gauge is metric that can go up and down
+type Gauge interface {
+	Add(value float64, labelValues ...string)
+}
+
+// Histogram samples observations into buckets
+type Histogram interface {
+	Observe(value float64, labelValues ...string)
+}
+
+// Registry creates metrics with provided names and label names, label values are passed in the same order on update.
+// Can be implemented on top of any metrics library.
+type Registry interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+}
+
+// ExpositionRegistry is Registry serving its metrics over HTTP in Prometheus text exposition format
+type ExpositionRegistry interface {
+	Registry
+	http.Handler
+}
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	m       sync.Mutex
+}
+
+func (m *metric) get(labelValues []string) *series {
+	key := strings.Join(labelValues, "\xff")
+
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(m.buckets)),
+		}
+
+		m.series[key] = s
+	}
+
+	return s
+}
+
+func (m *metric) Add(value float64, labelValues ...string) {
+	m.m.Lock()
+	m.get(labelValues).value += value
+	m.m.Unlock()
+}
+
+func (m *metric) Observe(value float64, labelValues ...string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	s := m.get(labelValues)
+
+	for i, bound := range m.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+
+	s.sum += value
+	s.count++
+}
+
+type registry struct {
+	metrics []*metric
+	names   map[string]*metric
+	m       sync.Mutex
+}
+
+// NewRegistry returns in-memory ExpositionRegistry, registering metric with existing name returns existing one
+func NewRegistry() ExpositionRegistry {
+	return &registry{
+		names: make(map[string]*metric),
+	}
+}
+
+func (r *registry) register(name, help, kind string, buckets []float64, labels []string) *metric {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if m, ok := r.names[name]; ok {
+		return m
+	}
+
+	buckets = append([]float64(nil), buckets...)
+
+	sort.Float64s(buckets)
+
+	m := &metric{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+
+	r.names[name] = m
+	r.metrics = append(r.metrics, m)
+
+	return m
+}
+
+func (r *registry) Counter(name, help string, labels ...string) Counter {
+	return r.register(name, help, typeCounter, nil, labels)
+}
+
+func (r *registry) Gauge(name, help string, labels ...string) Gauge {
+	return r.register(name, help, typeGauge, nil, labels)
+}
+
+func (r *registry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return r.register(name, help, typeHistogram, buckets, labels)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var sb strings.Builder
+
+	for i, name := range names {
+		var value string
+
+		if i < len(values) {
+			value = values[i]
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+
+		sb.WriteString(name + `="` + labelEscaper.Replace(value) + `"`)
+	}
+
+	if extraName != "" {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+
+		sb.WriteString(extraName + `="` + extraValue + `"`)
+	}
+
+	if sb.Len() == 0 {
+		return ""
+	}
+
+	return "{" + sb.String() + "}"
+}
+
+func (m *metric) write(w *bufio.Writer) {
+	m.m.Lock()
+	defer m.m.Unlock()
+
+	_, _ = w.WriteString("# HELP " + m.name + " " + helpEscaper.Replace(m.help) + "\n")
+	_, _ = w.WriteString("# TYPE " + m.name + " " + m.kind + "\n")
+
+	keys := make([]string, 0, len(m.series))
+
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+
+		if m.kind != typeHistogram {
+			_, _ = w.WriteString(m.name + formatLabels(m.labels, s.labelValues, "", "") + " " + formatFloat(s.value) + "\n")
+
+			continue
+		}
+
+		for i, bound := range m.buckets {
+			labels := formatLabels(m.labels, s.labelValues, "le", formatFloat(bound))
+
+			_, _ = w.WriteString(m.name + "_bucket" + labels + " " + strconv.FormatUint(s.counts[i], 10) + "\n")
+		}
+
+		labels := formatLabels(m.labels, s.labelValues, "", "")
+		count := strconv.FormatUint(s.count, 10)
+
+		_, _ = w.WriteString(m.name + "_bucket" + formatLabels(m.labels, s.labelValues, "le", "+Inf") + " " + count + "\n")
+		_, _ = w.WriteString(m.name + "_sum" + labels + " " + formatFloat(s.sum) + "\n")
+		_, _ = w.WriteString(m.name + "_count" + labels + " " + count + "\n")
+	}
+}
+
+// ServeHTTP writes all metrics in Prometheus text exposition format
+func (r *registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.m.Lock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.m.Unlock()
+
+	w.Header().Set("content-type", "text/plain; version=0.0.4; charset=utf-8")
+
+	bw := bufio.NewWriter(w)
+
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	_ = bw.Flush()
+}
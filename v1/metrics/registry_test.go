@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryExposition(t *testing.T) {
+	reg := NewRegistry()
+
+	counter := reg.Counter("test_total", "Test counter.", "kind")
+	gauge := reg.Gauge("test_active", "Test\ngauge.")
+	hist := reg.Histogram("test_seconds", "Test histogram.", []float64{1, 0.1}, "kind")
+
+	counter.Add(2, "b")
+	counter.Add(1, `a"\`)
+	gauge.Add(3)
+	gauge.Add(-1)
+	hist.Observe(0.05, "x")
+	hist.Observe(0.5, "x")
+	hist.Observe(5, "x")
+
+	assert.Equal(t, counter, reg.Counter("test_total", "Test counter.", "kind"))
+
+	rec := httptest.NewRecorder()
+
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	bs, err := io.ReadAll(rec.Body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("content-type"))
+	assert.Equal(t, `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{kind="a\"\\"} 1
+test_total{kind="b"} 2
+# HELP test_active Test\ngauge.
+# TYPE test_active gauge
+test_active 2
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{kind="x",le="0.1"} 1
+test_seconds_bucket{kind="x",le="1"} 2
+test_seconds_bucket{kind="x",le="+Inf"} 3
+test_seconds_sum{kind="x"} 5.55
+test_seconds_count{kind="x"} 3
+`, string(bs))
+}
@@ -0,0 +1,206 @@
+package wsgraphql
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+var (
+	// ErrPersistedQueryNotFound returned when operation refers to a persisted query hash unknown to the store,
+	// clients are expected to retry the operation providing full query
+	ErrPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+
+	// ErrPersistedQueryNotSupported returned when operation refers to a persisted query, but server has no
+	// persisted query store configured
+	ErrPersistedQueryNotSupported = errors.New("PersistedQueryNotSupported")
+
+	// ErrPersistedQueryHashMismatch returned when provided query does not match provided hash
+	ErrPersistedQueryHashMismatch = errors.New("provided sha does not match query")
+
+	// ErrPersistedQueryVersion returned when persisted query extension of unsupported version is provided
+	ErrPersistedQueryVersion = errors.New("unsupported persisted query version")
+)
+
+const (
+	persistedQueryExtension = "persistedQuery"
+	persistedQueryVersion   = 1
+)
+
+// PersistedQueryStore stores queries registered by clients for automatic persisted queries, keyed by lowercase
+// hex encoded SHA-256 hash of the query
+type PersistedQueryStore interface {
+	// Get returns query stored for provided hash, with ok set to false if no such query is stored
+	Get(ctx context.Context, hash string) (query string, ok bool, err error)
+
+	// Set stores query for provided hash
+	Set(ctx context.Context, hash string, query string) error
+}
+
+type memoryPersistedQueryEntry struct {
+	hash  string
+	query string
+}
+
+type memoryPersistedQueryStore struct {
+	entries  map[string]*list.Element
+	order    *list.List
+	capacity int
+	m        sync.Mutex
+}
+
+// NewMemoryPersistedQueryStore returns in-memory PersistedQueryStore, keeping up to capacity most recently used
+// queries, or unlimited amount if capacity is not positive
+func NewMemoryPersistedQueryStore(capacity int) PersistedQueryStore {
+	return &memoryPersistedQueryStore{
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		capacity: capacity,
+	}
+}
+
+func (store *memoryPersistedQueryStore) Get(ctx context.Context, hash string) (query string, ok bool, err error) {
+	store.m.Lock()
+	defer store.m.Unlock()
+
+	el, ok := store.entries[hash]
+	if !ok {
+		return "", false, nil
+	}
+
+	store.order.MoveToFront(el)
+
+	return el.Value.(*memoryPersistedQueryEntry).query, true, nil
+}
+
+func (store *memoryPersistedQueryStore) Set(ctx context.Context, hash string, query string) error {
+	store.m.Lock()
+	defer store.m.Unlock()
+
+	if el, ok := store.entries[hash]; ok {
+		store.order.MoveToFront(el)
+
+		return nil
+	}
+
+	store.entries[hash] = store.order.PushFront(&memoryPersistedQueryEntry{
+		hash:  hash,
+		query: query,
+	})
+
+	if store.capacity > 0 && store.order.Len() > store.capacity {
+		el := store.order.Back()
+
+		store.order.Remove(el)
+
+		delete(store.entries, el.Value.(*memoryPersistedQueryEntry).hash)
+	}
+
+	return nil
+}
+
+// persistedQueryError returns GraphQL error with Apollo-compatible error code extension
+func persistedQueryError(err error, code string, statusCode int) resultError {
+	ferr := gqlerrors.FormatError(err)
+
+	ferr.Extensions = map[string]interface{}{
+		"code": code,
+	}
+
+	return resultError{
+		Result: &graphql.Result{
+			Errors: []gqlerrors.FormattedError{ferr},
+		},
+		statusCode: statusCode,
+	}
+}
+
+// persistedQueryRegistration is a query provided alongside its hash, registered once operation passes validation
+type persistedQueryRegistration struct {
+	hash  string
+	query string
+}
+
+// hasPersistedQuery reports whether operation carries persisted query extension, its query may then be omitted
+func hasPersistedQuery(payload *apollows.PayloadOperation) bool {
+	_, ok := payload.Extensions[persistedQueryExtension].(map[string]interface{})
+
+	return ok
+}
+
+// loadPersistedQuery resolves operation query by its hash if persisted query extension is present, or schedules
+// registration of the query if it is provided alongside the hash, see registerPersistedQuery
+func (server *serverImpl) loadPersistedQuery(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+	ext, ok := payload.Extensions[persistedQueryExtension].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	if server.persistedQueries == nil {
+		if payload.Query != "" {
+			return nil
+		}
+
+		return persistedQueryError(ErrPersistedQueryNotSupported, "PERSISTED_QUERY_NOT_SUPPORTED", http.StatusOK)
+	}
+
+	if version, has := ext["version"]; has && version != float64(persistedQueryVersion) {
+		return persistedQueryError(ErrPersistedQueryVersion, "BAD_USER_INPUT", http.StatusBadRequest)
+	}
+
+	hash, _ := ext["sha256Hash"].(string)
+	if hash == "" {
+		return persistedQueryError(ErrPersistedQueryHashMismatch, "BAD_USER_INPUT", http.StatusBadRequest)
+	}
+
+	hash = strings.ToLower(hash)
+
+	if payload.Query == "" {
+		query, found, err := server.persistedQueries.Get(opctx, hash)
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return persistedQueryError(ErrPersistedQueryNotFound, "PERSISTED_QUERY_NOT_FOUND", http.StatusOK)
+		}
+
+		payload.Query = query
+
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(payload.Query))
+
+	if hex.EncodeToString(sum[:]) != hash {
+		return persistedQueryError(ErrPersistedQueryHashMismatch, "BAD_USER_INPUT", http.StatusBadRequest)
+	}
+
+	opctx.Set(contextKeyPersistedQuery, persistedQueryRegistration{
+		hash:  hash,
+		query: payload.Query,
+	})
+
+	return nil
+}
+
+// registerPersistedQuery stores query provided alongside its hash, must be called only after operation passed
+// validation, so invalid documents are never registered
+func (server *serverImpl) registerPersistedQuery(opctx mutable.Context) error {
+	reg, ok := opctx.Value(contextKeyPersistedQuery).(persistedQueryRegistration)
+	if !ok {
+		return nil
+	}
+
+	return server.persistedQueries.Set(opctx, reg.hash, reg.query)
+}
@@ -0,0 +1,294 @@
+package wsgraphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func testPersistedQueryBody(t *testing.T, query, hash string) string {
+	bs, err := json.Marshal(apollows.PayloadOperation{
+		Query: query,
+		Extensions: map[string]interface{}{
+			"persistedQuery": map[string]interface{}{
+				"version":    1,
+				"sha256Hash": hash,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	return string(bs)
+}
+
+func TestMemoryPersistedQueryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryPersistedQueryStore(2)
+
+	assert.NoError(t, store.Set(ctx, "a", "query a"))
+	assert.NoError(t, store.Set(ctx, "b", "query b"))
+
+	query, ok, err := store.Get(ctx, "a")
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "query a", query)
+
+	assert.NoError(t, store.Set(ctx, "c", "query c"))
+
+	_, ok, err = store.Get(ctx, "b")
+
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, _ = store.Get(ctx, "a")
+
+	assert.True(t, ok)
+
+	_, ok, _ = store.Get(ctx, "c")
+
+	assert.True(t, ok)
+}
+
+func TestNewServerPersistedQueriesPlain(t *testing.T) {
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithPersistedQueries(NewMemoryPersistedQueryStore(0)),
+	)
+
+	defer srv.Close()
+
+	query := `query { getFoo }`
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+
+	resp, pd := testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(t, "", hash))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pd.Errors, 1)
+	assert.Equal(t, ErrPersistedQueryNotFound.Error(), pd.Errors[0].Message)
+	assert.Equal(t, "PERSISTED_QUERY_NOT_FOUND", pd.Errors[0].Extensions["code"])
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(
+		t,
+		`query { bar }`,
+		hash,
+	))
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, pd.Errors, 1)
+	assert.Equal(t, ErrPersistedQueryHashMismatch.Error(), pd.Errors[0].Message)
+
+	// documents failing validation are not registered
+	invalid := `query { bar }`
+	invalidSum := sha256.Sum256([]byte(invalid))
+	invalidHash := hex.EncodeToString(invalidSum[:])
+
+	for _, q := range []string{invalid, ""} {
+		resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(
+			t,
+			q,
+			invalidHash,
+		))
+
+		assert.Len(t, pd.Errors, 1)
+	}
+
+	assert.Equal(t, ErrPersistedQueryNotFound.Error(), pd.Errors[0].Message)
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(
+		t,
+		query,
+		strings.ToUpper(hash),
+	))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(t, "", hash))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pd.Errors, 0)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+}
+
+func TestNewServerPersistedQueriesNotSupported(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer srv.Close()
+
+	resp, pd := testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(t, "", "abc"))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pd.Errors, 1)
+	assert.Equal(t, ErrPersistedQueryNotSupported.Error(), pd.Errors[0].Message)
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(
+		t,
+		`query { getFoo }`,
+		"abc",
+	))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+}
+
+func TestNewServerPersistedQueriesWebsocket(t *testing.T) {
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithPersistedQueries(NewMemoryPersistedQueryStore(0)),
+	)
+
+	defer srv.Close()
+
+	query := `query { getFoo }`
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.NoError(t, conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+	}))
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	for i, body := range []string{
+		testPersistedQueryBody(t, "", hash),
+		testPersistedQueryBody(t, query, hash),
+		testPersistedQueryBody(t, "", hash),
+	} {
+		var payload apollows.PayloadOperation
+
+		assert.NoError(t, json.Unmarshal([]byte(body), &payload))
+
+		assert.NoError(t, conn.WriteJSON(apollows.Message{
+			ID:   "1",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: payload,
+			},
+		}))
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, "1", msg.ID)
+
+		if i == 0 {
+			assert.Equal(t, apollows.OperationError, msg.Type)
+
+			errs, err := msg.Payload.ReadPayloadErrors()
+
+			assert.NoError(t, err)
+			assert.Len(t, errs, 1)
+			assert.Equal(t, ErrPersistedQueryNotFound.Error(), errs[0].Message)
+
+			continue
+		}
+
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		pd, err := msg.Payload.ReadPayloadData()
+
+		assert.NoError(t, err)
+		assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+		assert.NoError(t, conn.ReadJSON(&msg))
+		assert.Equal(t, apollows.OperationComplete, msg.Type)
+	}
+}
+
+func TestNewServerPersistedQueriesCallbacks(t *testing.T) {
+	var operations, done []string
+
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithPersistedQueries(NewMemoryPersistedQueryStore(0)),
+		WithCallbacks(Callbacks{
+			OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+				operations = append(operations, payload.Query)
+
+				return nil
+			},
+			OnOperationDone: func(opctx mutable.Context, payload *apollows.PayloadOperation, err error) error {
+				var msg string
+
+				if err != nil {
+					msg = err.Error()
+				}
+
+				done = append(done, msg)
+
+				return err
+			},
+		}),
+	)
+
+	defer srv.Close()
+
+	query := `mutation { setFoo(value: 1) }`
+	sum := sha256.Sum256([]byte(query))
+	hash := hex.EncodeToString(sum[:])
+
+	// lookup miss is reported to operation callbacks
+	resp, pd := testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(t, "", hash))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pd.Errors, 1)
+	assert.Equal(t, []string{""}, operations)
+	assert.Len(t, done, 1)
+	assert.Contains(t, done[0], ErrPersistedQueryNotFound.Error())
+
+	// mutation rejected over GET is not registered
+	extensions, err := json.Marshal(map[string]interface{}{
+		"persistedQuery": map[string]interface{}{
+			"version":    1,
+			"sha256Hash": hash,
+		},
+	})
+
+	assert.NoError(t, err)
+
+	resp, _ = testPlainRequest(
+		t,
+		http.MethodGet,
+		srv.URL+"?query="+url.QueryEscape(query)+"&extensions="+url.QueryEscape(string(extensions)),
+		"",
+		"application/json",
+		"",
+	)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", testPersistedQueryBody(t, "", hash))
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pd.Errors, 1)
+	assert.Equal(t, ErrPersistedQueryNotFound.Error(), pd.Errors[0].Message)
+	assert.Len(t, done, 3)
+}
@@ -0,0 +1,37 @@
+package wsgraphql
+
+import (
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// Protocol defines websocket subprotocol behavior, implemented by apollows.Protocol for graphql-ws and
+// graphql-transport-ws subprotocols
+type Protocol interface {
+	// String returns websocket subprotocol name
+	String() string
+
+	// ClientAction returns meaning of message type received from the client, messages of unknown type are ignored
+	ClientAction(t apollows.Operation) apollows.Action
+
+	// ServerOperation returns message type to be sent by the server for provided action, or empty string if action
+	// is not supported by the protocol
+	ServerOperation(a apollows.Action) apollows.Operation
+
+	// Authorize returns an error to terminate the connection with if client action is not allowed in current
+	// connection state
+	Authorize(a apollows.Action, initialized bool) error
+
+	// NotifyStopped returns true if operations stopped by the client are still followed by results and complete
+	// message
+	NotifyStopped() bool
+
+	// FormatErrors returns error message payload for provided operation errors
+	FormatErrors(errs []gqlerrors.FormattedError) interface{}
+
+	// InvalidMessageError returns error to terminate the connection with when client message can't be decoded
+	InvalidMessageError(err error) error
+
+	// CloseCode returns websocket close code for provided error
+	CloseCode(err apollows.Error) int
+}
@@ -0,0 +1,184 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+)
+
+// ErrRateLimited returned for operations exceeding configured rate limit
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitStore keeps token buckets of rate limiter
+type RateLimitStore interface {
+	// Take attempts to take a token from bucket identified by key, refilled with provided rate (tokens per second) up
+	// to burst tokens. If no token is available, returns ok set to false and duration until token will be available.
+	Take(ctx context.Context, key string, rate float64, burst int) (ok bool, retryAfter time.Duration, err error)
+}
+
+// RateLimit configures operation rate limiting, see WithRateLimit
+type RateLimit struct {
+	// Key returns bucket key for the request, such as API key from init payload (see ContextPayloadInit), header
+	// value (see ContextHTTPRequest) or connection ID (see ContextConnectionID). Requests with empty key are not
+	// limited. Remote IP address is used by default.
+	Key func(ctx context.Context) string
+
+	// Store keeps token buckets, in-memory store is used by default
+	Store RateLimitStore
+
+	// Rate is number of operations per second allowed for a single key
+	Rate float64
+
+	// Burst is maximum number of operations allowed at once for a single key
+	Burst int
+}
+
+type memoryBucket struct {
+	updated time.Time
+	tokens  float64
+}
+
+type memoryRateLimitStore struct {
+	buckets map[string]*memoryBucket
+	swept   time.Time
+	m       sync.Mutex
+}
+
+// NewMemoryRateLimitStore returns in-memory RateLimitStore, idle buckets are evicted periodically
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{
+		buckets: make(map[string]*memoryBucket),
+		swept:   time.Now(),
+	}
+}
+
+func refill(bucket *memoryBucket, now time.Time, rate float64, burst int) {
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+}
+
+// sweep evicts buckets refilled to burst, as they are indistinguishable from new ones
+func (store *memoryRateLimitStore) sweep(now time.Time, rate float64, burst int) {
+	if now.Sub(store.swept) < time.Minute {
+		return
+	}
+
+	store.swept = now
+
+	for key, bucket := range store.buckets {
+		refill(bucket, now, rate, burst)
+
+		if bucket.tokens >= float64(burst) {
+			delete(store.buckets, key)
+		}
+	}
+}
+
+func (store *memoryRateLimitStore) Take(
+	ctx context.Context,
+	key string,
+	rate float64,
+	burst int,
+) (ok bool, retryAfter time.Duration, err error) {
+	store.m.Lock()
+	defer store.m.Unlock()
+
+	now := time.Now()
+
+	store.sweep(now, rate, burst)
+
+	bucket, exists := store.buckets[key]
+	if !exists {
+		bucket = &memoryBucket{
+			updated: now,
+			tokens:  float64(burst),
+		}
+
+		store.buckets[key] = bucket
+	}
+
+	refill(bucket, now, rate, burst)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+
+		return true, 0, nil
+	}
+
+	if rate <= 0 {
+		return false, 0, nil
+	}
+
+	return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second)), nil
+}
+
+// rateLimitKeyRemoteAddr returns remote IP address of HTTP request
+func rateLimitKeyRemoteAddr(ctx context.Context) string {
+	r := ContextHTTPRequest(ctx)
+	if r == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// rateLimitError returns GraphQL error with retry-after information, in seconds
+func rateLimitError(retryAfter time.Duration) resultError {
+	ferr := gqlerrors.FormatError(ErrRateLimited)
+
+	ferr.Extensions = map[string]interface{}{
+		"code":       "RATE_LIMITED",
+		"retryAfter": int(math.Ceil(retryAfter.Seconds())),
+	}
+
+	return resultError{
+		Result: &graphql.Result{
+			Errors: []gqlerrors.FormattedError{ferr},
+		},
+		statusCode: http.StatusTooManyRequests,
+	}
+}
+
+// takeRateLimit returns an error if operation exceeds rate limit, along with retry-after HTTP header value
+func (server *serverImpl) takeRateLimit(ctx context.Context) (retryAfter string, err error) {
+	limit := server.rateLimit
+	if limit == nil {
+		return "", nil
+	}
+
+	key := limit.Key(ctx)
+	if key == "" {
+		return "", nil
+	}
+
+	ok, wait, err := limit.Store.Take(ctx, key, limit.Rate, limit.Burst)
+	if err != nil || ok {
+		return "", err
+	}
+
+	return strconv.Itoa(int(math.Ceil(wait.Seconds()))), rateLimitError(wait)
+}
+
+// takeHTTPRateLimit calls takeRateLimit for an operation of plain HTTP or SSE request, setting retry-after header
+// if rate limit is exceeded
+func (server *serverImpl) takeHTTPRateLimit(ctx context.Context, w http.ResponseWriter) error {
+	retryAfter, err := server.takeRateLimit(ctx)
+	if retryAfter != "" {
+		w.Header().Set("retry-after", retryAfter)
+	}
+
+	return err
+}
@@ -0,0 +1,251 @@
+package wsgraphql
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryRateLimitStore()
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := store.Take(ctx, "a", 1, 2)
+
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	ok, retryAfter, err := store.Take(ctx, "a", 1, 2)
+
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Second)
+
+	ok, _, err = store.Take(ctx, "b", 1, 2)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, retryAfter, err = store.Take(ctx, "c", 1000, 1)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Zero(t, retryAfter)
+
+	time.Sleep(time.Millisecond * 5)
+
+	ok, _, err = store.Take(ctx, "c", 1000, 1)
+
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestNewServerRateLimitPlain(t *testing.T) {
+	server, err := NewServer(testNewSchema(t), WithRateLimit(RateLimit{
+		Rate:  0.1,
+		Burst: 1,
+	}))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	body := `{"query":"query { getFoo }"}`
+
+	resp, pd := testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, pd.Errors)
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", body)
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("retry-after"))
+
+	if assert.Len(t, pd.Errors, 1) {
+		assert.Equal(t, ErrRateLimited.Error(), pd.Errors[0].Message)
+		assert.Equal(t, "RATE_LIMITED", pd.Errors[0].Extensions["code"])
+		assert.EqualValues(t, 10, pd.Errors[0].Extensions["retryAfter"])
+	}
+}
+
+func TestNewServerRateLimitWebsocket(t *testing.T) {
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithRateLimit(RateLimit{
+			Key: func(ctx context.Context) string {
+				return ContextConnectionID(ctx)
+			},
+			Rate:  0.5,
+			Burst: 1,
+		}),
+	)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, id := range []string{"1", "2"} {
+		err := conn.WriteJSON(apollows.Message{
+			ID:   id,
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `subscription { forever }`,
+				},
+			},
+		})
+
+		assert.NoError(t, err)
+	}
+
+	var msg apollows.Message
+
+	err := conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationError, msg.Type)
+	assert.Equal(t, "2", msg.ID)
+	assert.Contains(t, string(msg.Payload.RawMessage), `"code":"RATE_LIMITED"`)
+	assert.Contains(t, string(msg.Payload.RawMessage), `"retryAfter":2`)
+
+	// other connections use separate buckets
+	conn2 := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn2.Close()
+	}()
+
+	err = conn2.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getFoo }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	err = conn2.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationNext, msg.Type)
+}
+
+func TestNewServerRateLimitBatch(t *testing.T) {
+	server, err := NewServer(testNewSchema(t), WithRateLimit(RateLimit{
+		Rate:  0.1,
+		Burst: 2,
+	}))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	resp, pds := testBatchRequest(
+		t,
+		srv.URL,
+		`[{"query":"query { getFoo }"},{"query":"query { getFoo }"},{"query":"query { getFoo }"}]`,
+	)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var limited int
+
+	for _, pd := range pds {
+		if len(pd.Errors) > 0 {
+			assert.Equal(t, "RATE_LIMITED", pd.Errors[0].Extensions["code"])
+
+			limited++
+		}
+	}
+
+	assert.Equal(t, 1, limited)
+}
+
+func TestNewServerRateLimitSSE(t *testing.T) {
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithRateLimit(RateLimit{
+			Rate:  0.1,
+			Burst: 2,
+		}),
+	)
+
+	defer srv.Close()
+
+	op := apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	}
+
+	resp := testSSERequest(t, http.MethodPost, srv.URL, op, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPut, srv.URL, nil, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	token := string(bs)
+
+	stream := testSSERequest(t, http.MethodGet, srv.URL, nil, http.Header{
+		"Accept":             []string{"text/event-stream"},
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	defer func() {
+		_ = stream.Body.Close()
+	}()
+
+	for idx, status := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		op.Extensions = map[string]interface{}{
+			"operationId": strconv.Itoa(idx),
+		}
+
+		resp = testSSERequest(t, http.MethodPost, srv.URL, op, http.Header{
+			SSEStreamTokenHeader: []string{token},
+		})
+
+		assert.Equal(t, status, resp.StatusCode)
+		assert.NoError(t, resp.Body.Close())
+	}
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, op, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("retry-after"))
+	assert.NoError(t, resp.Body.Close())
+}
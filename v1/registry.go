@@ -0,0 +1,137 @@
+package wsgraphql
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+)
+
+// ConnectionInfo describes active websocket connection
+type ConnectionInfo struct {
+	// Context is request-scoped context of the connection
+	Context mutable.Context
+
+	// Init is connection initialization payload, nil until connection is acknowledged
+	Init apollows.PayloadInit
+
+	// ID uniquely identifies connection within the server, also available with ContextConnectionID
+	ID string
+
+	// Protocol is websocket subprotocol name
+	Protocol string
+
+	// RemoteAddr is network address of the client
+	RemoteAddr string
+
+	// Operations lists IDs of running operations
+	Operations []string
+}
+
+type operationCancelled struct {
+	err error
+}
+
+func (server *serverImpl) findRequest(connectionID string) *websocketRequest {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	for req := range server.connections.requests {
+		if req.id == connectionID {
+			return req
+		}
+	}
+
+	return nil
+}
+
+// Connections implementation
+func (server *serverImpl) Connections() (res []ConnectionInfo) {
+	for _, req := range server.activeRequests() {
+		info := ConnectionInfo{
+			Context:  req.ctx,
+			ID:       req.id,
+			Protocol: req.protocol.String(),
+		}
+
+		if r := ContextHTTPRequest(req.ctx); r != nil {
+			info.RemoteAddr = r.RemoteAddr
+		}
+
+		req.m.RLock()
+
+		info.Init = req.initPayload
+
+		for id := range req.operations {
+			info.Operations = append(info.Operations, id)
+		}
+
+		req.m.RUnlock()
+
+		sort.Strings(info.Operations)
+
+		res = append(res, info)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return len(res[i].ID) < len(res[j].ID) || len(res[i].ID) == len(res[j].ID) && res[i].ID < res[j].ID
+	})
+
+	return res
+}
+
+// CancelOperation implementation
+func (server *serverImpl) CancelOperation(connectionID, operationID string, err error) bool {
+	req := server.findRequest(connectionID)
+	if req == nil {
+		return false
+	}
+
+	req.m.RLock()
+	opctx, ok := req.operations[operationID]
+	req.m.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	opctx.Set(contextKeyOperationCancelled, operationCancelled{
+		err: err,
+	})
+	opctx.Cancel()
+
+	return true
+}
+
+func (req *websocketRequest) close(err apollows.Error) {
+	select {
+	case req.closing <- err:
+	default:
+	}
+}
+
+// CloseConnection implementation
+func (server *serverImpl) CloseConnection(connectionID string, err apollows.Error) bool {
+	req := server.findRequest(connectionID)
+	if req == nil {
+		return false
+	}
+
+	req.close(err)
+
+	return true
+}
+
+// CloseContextConnection closes websocket connection of provided request or operation context with the error, same as
+// Server.CloseConnection. Returns false if context does not belong to a websocket connection.
+func CloseContextConnection(ctx context.Context, err apollows.Error) bool {
+	req, ok := ctx.Value(contextKeyWebsocketRequest).(*websocketRequest)
+	if !ok {
+		return false
+	}
+
+	req.close(err)
+
+	return true
+}
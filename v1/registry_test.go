@@ -0,0 +1,134 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConnections(t *testing.T) {
+	disconnected := make(chan error, 1)
+
+	server, err := NewServer(testNewSchema(t), WithCallbacks(Callbacks{
+		OnDisconnect: func(reqctx mutable.Context, origerr error) error {
+			disconnected <- origerr
+
+			return origerr
+		},
+	}))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	err = conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationConnectionInit,
+		Payload: apollows.Data{
+			Value: apollows.PayloadInit{
+				"token": "foo",
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	for _, id := range []string{"1", "2"} {
+		err = conn.WriteJSON(apollows.Message{
+			ID:   id,
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `subscription { forever }`,
+				},
+			},
+		})
+
+		assert.NoError(t, err)
+	}
+
+	var conns []ConnectionInfo
+
+	assert.Eventually(t, func() bool {
+		conns = server.Connections()
+
+		return len(conns) == 1 && len(conns[0].Operations) == 2
+	}, time.Second, time.Millisecond)
+
+	info := conns[0]
+
+	assert.Equal(t, apollows.WebsocketSubprotocolGraphqlTransportWS.String(), info.Protocol)
+	assert.Equal(t, "foo", info.Init["token"])
+	assert.Equal(t, []string{"1", "2"}, info.Operations)
+	assert.Equal(t, conn.LocalAddr().String(), info.RemoteAddr)
+	assert.Equal(t, info.ID, ContextConnectionID(info.Context))
+
+	assert.False(t, server.CancelOperation(info.ID, "3", nil))
+	assert.False(t, server.CancelOperation("unknown", "1", nil))
+	assert.True(t, server.CancelOperation(info.ID, "1", nil))
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+	assert.Equal(t, "1", msg.ID)
+
+	assert.True(t, server.CancelOperation(info.ID, "2", errors.New("revoked")))
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationError, msg.Type)
+	assert.Equal(t, "2", msg.ID)
+	assert.Contains(t, string(msg.Payload.RawMessage), "revoked")
+
+	assert.False(t, server.CloseConnection("unknown", apollows.EventUnauthorized))
+	assert.False(t, CloseContextConnection(context.Background(), apollows.EventUnauthorized))
+	assert.True(t, server.CloseConnection(info.ID, apollows.EventUnauthorized))
+	assert.True(t, CloseContextConnection(info.Context, apollows.EventUnauthorized))
+
+	err = conn.ReadJSON(&msg)
+
+	assert.True(t, websocket.IsCloseError(err, int(apollows.EventUnauthorized)))
+
+	select {
+	case err = <-disconnected:
+		assert.ErrorIs(t, err, apollows.EventUnauthorized)
+	case <-time.After(time.Second):
+		assert.Fail(t, "disconnect not reported")
+	}
+
+	assert.Eventually(t, func() bool {
+		return len(server.Connections()) == 0
+	}, time.Second, time.Millisecond)
+}
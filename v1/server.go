@@ -2,13 +2,15 @@ package wsgraphql
 
 import (
 	"errors"
+	"mime"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/bitquery/wsgraphql/v1/apollows"
 	"github.com/bitquery/wsgraphql/v1/mutable"
 	"github.com/graphql-go/graphql"
-	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
 )
 
 var (
@@ -16,19 +18,107 @@ var (
 	errReflectExtensions = errors.New("could not reflect schema extensions")
 )
 
+// httpError carries HTTP response status code to reply with
+type httpError struct {
+	error
+	statusCode int
+}
+
+func (e httpError) Unwrap() error {
+	return e.error
+}
+
+func errorStatusCode(err error) int {
+	if res, ok := err.(resultError); ok && res.statusCode != 0 {
+		return res.statusCode
+	}
+
+	var herr httpError
+
+	if errors.As(err, &herr) {
+		return herr.statusCode
+	}
+
+	var awerr apollows.Error
+
+	if errors.As(err, &awerr) {
+		switch awerr.EventMessageType() {
+		case apollows.EventUnauthorized:
+			return http.StatusUnauthorized
+		case apollows.EventForbidden:
+			return http.StatusForbidden
+		}
+	}
+
+	return http.StatusBadRequest
+}
+
+func headerContainsMediaType(header http.Header, key, mediaType string) bool {
+	for _, value := range header.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err == nil && mt == mediaType {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func headerContainsToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// isWebsocketRequest reports whether request asks for websocket upgrade, as opposed to other upgrades, such as h2c
+func isWebsocketRequest(r *http.Request) bool {
+	return headerContainsToken(r.Header, "connection", "upgrade") &&
+		headerContainsToken(r.Header, "upgrade", "websocket")
+}
+
 type serverConfig struct {
 	upgrader              Upgrader
 	callbacks             Callbacks
 	rootObject            map[string]interface{}
-	subscriptionProtocols map[apollows.Protocol]struct{}
+	subscriptionProtocols map[string]Protocol
 	keepalive             time.Duration
+	pingInterval          time.Duration
+	pongTimeout           time.Duration
 	connectTimeout        time.Duration
+	shutdownCloseCode     apollows.MessageType
+	persistedQueries      PersistedQueryStore
+	batchConcurrency      int
+	maxBatchSize          int
+	maxOperations         int
+	maxOperationsPolicy   OperationLimitPolicy
+	connectionBuffer      int
+	subscriptionBuffer    int
+	overflowPolicy        OverflowPolicy
+	writeTimeout          time.Duration
+	queryLimits           queryLimits
+	costAnalysis          *CostAnalysis
+	rateLimit             *RateLimit
+	ssePath               string
+	sseReservationTimeout time.Duration
+	maxSSEReservations    int
 	rejectHTTPQueries     bool
+	rejectSSE             bool
+	rejectWebsocket       bool
 }
 
 type serverImpl struct {
-	extensions []graphql.Extension
-	schema     graphql.Schema
+	sse         sseStreams
+	connections connections
+	extensions  []graphql.Extension
+	schema      graphql.Schema
 	serverConfig
 }
 
@@ -45,15 +135,7 @@ func (server *serverImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		err = server.callbacks.OnDisconnect(reqctx, err)
 
 		if err != nil {
-			if _, ok := err.(resultError); !ok {
-				err = resultError{
-					Result: &graphql.Result{
-						Errors: []gqlerrors.FormattedError{
-							gqlerrors.FormatError(err),
-						},
-					},
-				}
-			}
+			err = toResultError(err)
 		}
 
 		server.callbacks.OnRequestDone(reqctx, r, w, err)
@@ -66,11 +148,69 @@ func (server *serverImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Header.Get("connection") == "" || r.Header.Get("upgrade") == "" || server.upgrader == nil {
-		err = server.servePlainRequest(reqctx, w, r)
+	if server.isShutdown() {
+		err = errServerClosed
 
 		return
 	}
 
-	err = server.serveWebsocketRequest(reqctx, w, r)
+	switch {
+	case server.upgrader != nil && isWebsocketRequest(r):
+		err = server.serveWebsocketRequest(reqctx, w, r)
+	case server.isSSERequest(r):
+		err = server.serveSSERequest(reqctx, w, r)
+	default:
+		err = server.servePlainRequest(reqctx, w, r)
+	}
+}
+
+func (server *serverImpl) execute(
+	params graphql.Params,
+	astdoc *ast.Document,
+	subscription bool,
+) (cres chan *graphql.Result) {
+	execParams := graphql.ExecuteParams{
+		Schema:        server.schema,
+		Root:          server.rootObject,
+		AST:           astdoc,
+		OperationName: params.OperationName,
+		Args:          params.VariableValues,
+		Context:       params.Context,
+	}
+
+	if subscription {
+		cres = graphql.ExecuteSubscription(execParams)
+
+		if server.costAnalysis == nil || !server.costAnalysis.Extensions {
+			return cres
+		}
+
+		out := make(chan *graphql.Result)
+
+		go func() {
+			defer close(out)
+
+			for res := range cres {
+				server.reportCost(params.Context, res)
+
+				select {
+				case out <- res:
+				case <-params.Context.Done():
+					return
+				}
+			}
+		}()
+
+		return out
+	}
+
+	res := graphql.Execute(execParams)
+
+	server.reportCost(params.Context, res)
+
+	cres = make(chan *graphql.Result, 1)
+	cres <- res
+	close(cres)
+
+	return cres
 }
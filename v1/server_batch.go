@@ -0,0 +1,148 @@
+package wsgraphql
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+)
+
+// DefaultMaxBatchSize is maximum number of operations of a single batched plain HTTP request by default
+const DefaultMaxBatchSize = 32
+
+var (
+	errBatchEmpty        = httpError{errors.New("batch is empty"), http.StatusBadRequest}
+	errBatchTooLarge     = httpError{errors.New("batch is too large"), http.StatusBadRequest}
+	errBatchSubscription = errors.New("subscriptions are not supported in batched requests")
+)
+
+// servePlainBatch executes batch of operations, replying with array of results in the same order
+func (server *serverImpl) servePlainBatch(
+	reqctx mutable.Context,
+	w http.ResponseWriter,
+	payloads []apollows.PayloadOperation,
+) (err error) {
+	limit := server.batchConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+
+	results := make([]*graphql.Result, len(payloads))
+	sem := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+
+	for i := range payloads {
+		sem <- struct{}{}
+
+		wg.Add(1)
+
+		go func(i int) {
+			defer func() {
+				<-sem
+
+				wg.Done()
+			}()
+
+			results[i] = server.serveBatchOperation(reqctx, &payloads[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	bs, err := json.Marshal(results)
+	if err != nil {
+		return
+	}
+
+	bs = append(bs, '\n')
+
+	w.Header().Set("content-type", contextHTTPResponseMediaType(reqctx)+"; charset=utf-8")
+	w.Header().Set("content-length", strconv.Itoa(len(bs)))
+
+	reqctx.Set(ContextKeyHTTPResponseStarted, true)
+
+	_, err = w.Write(bs)
+
+	return err
+}
+
+// serveBatchOperation executes single operation of a batch, any error terminating the operation is returned as
+// its result
+func (server *serverImpl) serveBatchOperation(
+	reqctx mutable.Context,
+	payload *apollows.PayloadOperation,
+) (result *graphql.Result) {
+	opctx := mutable.NewMutableContext(reqctx)
+
+	opctx.Set(ContextKeyOperationContext, opctx)
+
+	defer opctx.Cancel()
+
+	// every operation of a batch takes its own token, retry-after header is not set as response is not rejected
+	_, err := server.takeRateLimit(opctx)
+	if err != nil {
+		return toResultError(err).Result
+	}
+
+	if payload.Query == "" && !hasPersistedQuery(payload) {
+		return toResultError(errQueryRequired).Result
+	}
+
+	err = func() (err error) {
+		defer func() {
+			err = server.callbacks.OnOperationDone(opctx, payload, err)
+		}()
+
+		err = server.callbacks.OnOperation(opctx, payload)
+		if err != nil {
+			return err
+		}
+
+		err = server.loadPersistedQuery(opctx, payload)
+		if err != nil {
+			return err
+		}
+
+		params, astdoc, subscription, vresult := server.parseAST(opctx, payload)
+
+		err = server.callbacks.OnOperationValidation(opctx, payload, vresult)
+		if err != nil {
+			return err
+		}
+
+		if vresult != nil {
+			return resultError{Result: vresult}
+		}
+
+		err = server.registerPersistedQuery(opctx)
+		if err != nil {
+			return err
+		}
+
+		if subscription {
+			return errBatchSubscription
+		}
+
+		for res := range server.execute(params, astdoc, false) {
+			err = server.callbacks.OnOperationResult(opctx, payload, res)
+			if err != nil {
+				return err
+			}
+
+			result = res
+		}
+
+		return nil
+	}()
+	if err != nil {
+		return toResultError(err).Result
+	}
+
+	return result
+}
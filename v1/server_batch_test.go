@@ -0,0 +1,99 @@
+package wsgraphql
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBatchRequest(t *testing.T, u, body string) (resp *http.Response, pds []apollows.PayloadDataResponse) {
+	resp, err := http.Post(u, "application/json", strings.NewReader(body))
+
+	assert.NoError(t, err)
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	if resp.StatusCode == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(bs, &pds))
+	}
+
+	return resp, pds
+}
+
+func TestNewServerPlainBatch(t *testing.T) {
+	var operations, done int32
+
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlWS,
+		WithBatchConcurrency(2),
+		WithCallbacks(Callbacks{
+			OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+				atomic.AddInt32(&operations, 1)
+
+				return nil
+			},
+			OnOperationDone: func(opctx mutable.Context, payload *apollows.PayloadOperation, err error) error {
+				atomic.AddInt32(&done, 1)
+
+				return err
+			},
+		}),
+	)
+
+	defer srv.Close()
+
+	resp, pds := testBatchRequest(t, srv.URL, ` [
+		{"query": "query { getFoo }"},
+		{"query": "mutation { setFoo(value: 1) }"},
+		{"query": "query { bar }"},
+		{"query": "subscription { fooUpdates }"},
+		{"query": ""}
+	]`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.Len(t, pds, 5)
+	assert.EqualValues(t, 123, pds[0].Data["getFoo"])
+	assert.EqualValues(t, true, pds[1].Data["setFoo"])
+	assert.Len(t, pds[2].Errors, 1)
+	assert.Len(t, pds[3].Errors, 1)
+	assert.Contains(t, pds[3].Errors[0].Message, "batched")
+	assert.Len(t, pds[4].Errors, 1)
+	assert.EqualValues(t, 4, atomic.LoadInt32(&operations))
+	assert.EqualValues(t, 4, atomic.LoadInt32(&done))
+
+	resp, _ = testBatchRequest(t, srv.URL, `[]`)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, pds = testBatchRequest(t, srv.URL, `[{"query": "query { getFoo }"}]`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pds, 1)
+}
+
+func TestNewServerPlainBatchSize(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithMaxBatchSize(2))
+
+	defer srv.Close()
+
+	resp, pds := testBatchRequest(t, srv.URL, `[{"query": "query { getFoo }"}, {"query": "query { getFoo }"}]`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, pds, 2)
+
+	resp, _ = testBatchRequest(t, srv.URL, `[{"query": "{ getFoo }"}, {"query": "{ getFoo }"}, {"query": "{ getFoo }"}]`)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,189 @@
+package wsgraphql
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	mediaTypeMultipartMixed = "multipart/mixed"
+	multipartBoundary       = "-"
+)
+
+// multipartAccept describes multipart/mixed acceptance by the client
+type multipartAccept struct {
+	// accepted is set if client accepts multipart/mixed responses
+	accepted bool
+	// envelope is set if client requested Apollo multipart subscriptions format, where each result is wrapped
+	// into payload field
+	envelope bool
+}
+
+// multipartAccepted returns multipart/mixed acceptance as specified by Accept header
+func multipartAccepted(header http.Header) (res multipartAccept) {
+	for _, value := range header.Values("accept") {
+		for _, part := range strings.Split(value, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil || mt != mediaTypeMultipartMixed {
+				continue
+			}
+
+			if v, has := params["q"]; has {
+				q, perr := strconv.ParseFloat(v, 64)
+				if perr != nil || q <= 0 {
+					continue
+				}
+			}
+
+			res.accepted = true
+
+			if _, has := params["subscriptionspec"]; has {
+				res.envelope = true
+			}
+		}
+	}
+
+	return res
+}
+
+// multipartPayload is a part of Apollo multipart subscriptions response
+type multipartPayload struct {
+	Payload *graphql.Result `json:"payload"`
+	Errors  interface{}     `json:"errors,omitempty"`
+}
+
+func (server *serverImpl) serveMultipart(
+	reqctx mutable.Context,
+	opctx mutable.Context,
+	payload *apollows.PayloadOperation,
+	params graphql.Params,
+	cres chan *graphql.Result,
+	w http.ResponseWriter,
+	accept multipartAccept,
+) (err error) {
+	if !server.registerStream(reqctx) {
+		return errServerClosed
+	}
+
+	defer server.unregisterStream(reqctx)
+
+	flusher := writeMultipartHeaders(reqctx, w)
+
+	err = writeMultipartChunk(w, flusher, "\r\n--"+multipartBoundary)
+	if err != nil {
+		return
+	}
+
+	var tickerch <-chan time.Time
+
+	if server.keepalive > 0 {
+		ticker := time.NewTicker(server.keepalive)
+
+		defer ticker.Stop()
+
+		tickerch = ticker.C
+	}
+
+	shutdownch := server.shutdownChannel(opctx)
+
+	for {
+		select {
+		case <-shutdownch:
+			return writeMultipartChunk(w, flusher, "--\r\n")
+		case <-params.Context.Done():
+			// response is terminated properly, even though operation was cancelled
+			_ = writeMultipartChunk(w, flusher, "--\r\n")
+
+			return params.Context.Err()
+		case <-tickerch:
+			err = writeMultipartPart(w, flusher, struct{}{})
+		case result, ok := <-cres:
+			if !ok {
+				return writeMultipartChunk(w, flusher, "--\r\n")
+			}
+
+			err = server.callbacks.OnOperationResult(opctx, payload, result)
+			if err != nil {
+				_ = writeMultipartPart(w, flusher, multipartResultPart(toResultError(err).Result, accept, true))
+				_ = writeMultipartChunk(w, flusher, "--\r\n")
+
+				return
+			}
+
+			err = writeMultipartPart(w, flusher, multipartResultPart(result, accept, false))
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// multipartResultPart returns part value for provided result, wrapping it if client requested Apollo format
+func multipartResultPart(result *graphql.Result, accept multipartAccept, fatal bool) interface{} {
+	if !accept.envelope {
+		return result
+	}
+
+	if fatal {
+		return multipartPayload{
+			Errors: result.Errors,
+		}
+	}
+
+	return multipartPayload{
+		Payload: result,
+	}
+}
+
+func writeMultipartHeaders(reqctx mutable.Context, w http.ResponseWriter) http.Flusher {
+	w.Header().Set("content-type", mediaTypeMultipartMixed+`; boundary="`+multipartBoundary+`"`)
+	w.Header().Set("cache-control", "no-cache")
+	w.Header().Set("x-content-type-options", "nosniff")
+	w.Header().Set("x-accel-buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	reqctx.Set(ContextKeyHTTPResponseStarted, true)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return flusher
+}
+
+// writeMultipartPart writes JSON encoded part followed by delimiter, part is expected to be preceded by delimiter
+func writeMultipartPart(w http.ResponseWriter, flusher http.Flusher, data interface{}) error {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return writeMultipartChunk(
+		w,
+		flusher,
+		"\r\nContent-Type: "+mediaTypeJSON+"; charset=utf-8\r\n\r\n"+string(bs)+"\r\n--"+multipartBoundary,
+	)
+}
+
+func writeMultipartChunk(w http.ResponseWriter, flusher http.Flusher, chunk string) error {
+	_, err := w.Write([]byte(chunk))
+	if err != nil {
+		return err
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return nil
+}
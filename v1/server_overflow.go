@@ -0,0 +1,204 @@
+package wsgraphql
+
+import (
+	"sync"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+)
+
+// OverflowPolicy defines handling of operation results not fitting into outgoing buffer of a slow websocket client
+type OverflowPolicy int
+
+const (
+	// OverflowBlock suspends the operation until buffer has space
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest pending result of the operation
+	OverflowDropOldest
+
+	// OverflowKeepLatest discards all pending results of the operation, keeping only the latest one
+	OverflowKeepLatest
+
+	// OverflowDisconnect discards the result and closes the connection with apollows.EventSlowConsumer code
+	OverflowDisconnect
+)
+
+type queuedMessage struct {
+	*apollows.Message
+	data bool
+}
+
+// operationQueue buffers outgoing messages of a single operation, so slow client does not block the operation
+type operationQueue struct {
+	req      *websocketRequest
+	opctx    mutable.Context
+	messages []queuedMessage
+	signal   chan struct{}
+	space    chan struct{}
+	done     chan struct{}
+	capacity int
+	m        sync.Mutex
+	closed   bool
+}
+
+func (server *serverImpl) operationQueueEnabled() bool {
+	return server.overflowPolicy != OverflowBlock || server.subscriptionBuffer > 0
+}
+
+func (req *websocketRequest) newOperationQueue(opctx mutable.Context) *operationQueue {
+	capacity := req.server.subscriptionBuffer
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	q := &operationQueue{
+		req:      req,
+		opctx:    opctx,
+		signal:   make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		capacity: capacity,
+	}
+
+	go q.run()
+
+	return q
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// dropData removes pending results according to overflow policy, returns false if message should not be queued
+func (q *operationQueue) dropData() bool {
+	switch q.req.server.overflowPolicy {
+	case OverflowDropOldest:
+		for i, msg := range q.messages {
+			if msg.data {
+				q.messages = append(q.messages[:i], q.messages[i+1:]...)
+
+				break
+			}
+		}
+	case OverflowKeepLatest:
+		messages := q.messages[:0]
+
+		for _, msg := range q.messages {
+			if !msg.data {
+				messages = append(messages, msg)
+			}
+		}
+
+		q.messages = messages
+	case OverflowDisconnect:
+		select {
+		case q.req.closing <- apollows.EventSlowConsumer:
+		default:
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// push queues the message, only results are subject to buffer capacity
+func (q *operationQueue) push(msg *apollows.Message, data bool) {
+	for {
+		q.m.Lock()
+
+		if !data || len(q.messages) < q.capacity {
+			q.messages = append(q.messages, queuedMessage{
+				Message: msg,
+				data:    data,
+			})
+			q.m.Unlock()
+
+			notify(q.signal)
+
+			return
+		}
+
+		if q.req.server.overflowPolicy != OverflowBlock {
+			queue := q.dropData()
+			if queue {
+				q.messages = append(q.messages, queuedMessage{
+					Message: msg,
+					data:    data,
+				})
+			}
+
+			q.m.Unlock()
+
+			q.req.server.callbacks.OnOverflow(q.opctx, q.req.server.overflowPolicy)
+
+			return
+		}
+
+		q.m.Unlock()
+
+		select {
+		case <-q.space:
+		case <-q.req.ctx.Done():
+			return
+		}
+	}
+}
+
+// run forwards queued messages to connection until queue is closed and flushed
+func (q *operationQueue) run() {
+	defer close(q.done)
+
+	for {
+		q.m.Lock()
+
+		if len(q.messages) == 0 {
+			closed := q.closed
+
+			q.m.Unlock()
+
+			if closed {
+				return
+			}
+
+			select {
+			case <-q.signal:
+			case <-q.req.ctx.Done():
+				return
+			}
+
+			continue
+		}
+
+		msg := q.messages[0]
+
+		q.messages = q.messages[1:]
+
+		q.m.Unlock()
+
+		notify(q.space)
+
+		select {
+		case q.req.outgoing <- outgoingMessage{
+			Message: msg.Message,
+		}:
+		case <-q.req.ctx.Done():
+			return
+		}
+	}
+}
+
+// close awaits queued messages to be forwarded to connection
+func (q *operationQueue) close() {
+	q.m.Lock()
+	q.closed = true
+	q.m.Unlock()
+
+	notify(q.signal)
+
+	<-q.done
+}
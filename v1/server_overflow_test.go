@@ -0,0 +1,166 @@
+package wsgraphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// testGatedUpgrader provides connections suspending results delivery until gate is closed, simulating slow client
+type testGatedUpgrader struct {
+	Upgrader
+	gate chan struct{}
+}
+
+type testGatedConn struct {
+	Conn
+	gate chan struct{}
+}
+
+func (u testGatedUpgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (Conn, error) {
+	conn, err := u.Upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return testGatedConn{
+		Conn: conn,
+		gate: u.gate,
+	}, nil
+}
+
+func (conn testGatedConn) WriteJSON(v interface{}) error {
+	if msg, ok := v.(*apollows.Message); ok && msg.Type == apollows.OperationNext {
+		<-conn.gate
+	}
+
+	return conn.Conn.WriteJSON(v)
+}
+
+func testNewServerOverflow(t *testing.T, policy OverflowPolicy) (*httptest.Server, chan OverflowPolicy) {
+	gate := make(chan struct{})
+	overflows := make(chan OverflowPolicy, 100)
+
+	var once sync.Once
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithUpgrader(testGatedUpgrader{
+			Upgrader: NewStdUpgrader(apollows.WebsocketSubprotocolGraphqlTransportWS),
+			gate:     gate,
+		}),
+		WithOutgoingBuffer(1, 2),
+		WithOverflowPolicy(policy),
+		WithCallbacks(Callbacks{
+			OnOverflow: func(opctx mutable.Context, policy OverflowPolicy) {
+				overflows <- policy
+
+				once.Do(func() {
+					close(gate)
+				})
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server), overflows
+}
+
+func TestServerOverflowKeepLatest(t *testing.T) {
+	srv, overflows := testNewServerOverflow(t, OverflowKeepLatest)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err := conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooMany }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	var (
+		msg    apollows.Message
+		values []int
+	)
+
+	for {
+		err = conn.ReadJSON(&msg)
+
+		assert.NoError(t, err)
+
+		if err != nil || msg.Type == apollows.OperationComplete {
+			break
+		}
+
+		assert.Equal(t, apollows.OperationNext, msg.Type)
+
+		var res struct {
+			Data struct {
+				FooMany int `json:"fooMany"`
+			} `json:"data"`
+		}
+
+		err = json.Unmarshal(msg.Payload.RawMessage, &res)
+
+		assert.NoError(t, err)
+
+		values = append(values, res.Data.FooMany)
+	}
+
+	assert.Equal(t, OverflowKeepLatest, <-overflows)
+	assert.Less(t, len(values), 100)
+	assert.Equal(t, 100, values[len(values)-1])
+	assert.IsIncreasing(t, values)
+}
+
+func TestServerOverflowDisconnect(t *testing.T) {
+	srv, overflows := testNewServerOverflow(t, OverflowDisconnect)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err := conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooMany }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	for err == nil {
+		err = conn.ReadJSON(&msg)
+	}
+
+	assert.True(t, websocket.IsCloseError(err, int(apollows.EventSlowConsumer)))
+	assert.Equal(t, OverflowDisconnect, <-overflows)
+}
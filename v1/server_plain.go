@@ -1,17 +1,55 @@
 package wsgraphql
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/bitquery/wsgraphql/v1/apollows"
 	"github.com/bitquery/wsgraphql/v1/mutable"
 	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
 )
 
+const (
+	mediaTypeJSON                = "application/json"
+	mediaTypeGraphQLResponseJSON = "application/graphql-response+json"
+)
+
+var (
+	errQueryRequired        = httpError{errors.New("query is required"), http.StatusBadRequest}
+	errMutationOverGET      = httpError{errors.New("mutations are not allowed over GET"), http.StatusMethodNotAllowed}
+	errUnsupportedMediaType = httpError{errors.New("unsupported media type"), http.StatusUnsupportedMediaType}
+	errNotAcceptable        = httpError{errors.New("not acceptable"), http.StatusNotAcceptable}
+)
+
+var plainMediaTypes = []string{
+	mediaTypeGraphQLResponseJSON,
+	mediaTypeJSON,
+}
+
+type contextKeyHTTPResponseMediaTypeT struct{}
+
+var contextKeyHTTPResponseMediaType = contextKeyHTTPResponseMediaTypeT{}
+
+func contextHTTPResponseMediaType(ctx context.Context) string {
+	mt, _ := ctx.Value(contextKeyHTTPResponseMediaType).(string)
+	if mt == "" {
+		return mediaTypeJSON
+	}
+
+	return mt
+}
+
 type resultError struct {
 	*graphql.Result
+	statusCode int
 }
 
 func (r resultError) Error() string {
@@ -20,6 +58,204 @@ func (r resultError) Error() string {
 	return string(bs)
 }
 
+func toResultError(err error) resultError {
+	res, ok := err.(resultError)
+	if ok {
+		return res
+	}
+
+	return resultError{
+		Result: &graphql.Result{
+			Errors: []gqlerrors.FormattedError{
+				gqlerrors.FormatError(err),
+			},
+		},
+		statusCode: errorStatusCode(err),
+	}
+}
+
+// checkPayloadContentType ensures request body, if content type is specified, is JSON
+func checkPayloadContentType(r *http.Request) error {
+	if ct := r.Header.Get("content-type"); ct != "" {
+		mt, _, _ := mime.ParseMediaType(ct)
+		if mt != mediaTypeJSON {
+			return errUnsupportedMediaType
+		}
+	}
+
+	return nil
+}
+
+// readPayloadOperations decodes either single operation or, if request body is a JSON array, batch of at most
+// maxBatch operations
+func readPayloadOperations(
+	r *http.Request,
+	maxBatch int,
+) (payloads []apollows.PayloadOperation, batch bool, err error) {
+	if r.Method == http.MethodGet {
+		payloads = make([]apollows.PayloadOperation, 1)
+
+		return payloads, false, readPayloadOperation(r, &payloads[0])
+	}
+
+	err = checkPayloadContentType(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var raw json.RawMessage
+
+	err = json.NewDecoder(r.Body).Decode(&raw)
+	if err != nil {
+		return nil, false, httpError{err, http.StatusBadRequest}
+	}
+
+	trimmed := bytes.TrimLeft(raw, " \t\r\n")
+
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(raw, &payloads)
+		if err != nil {
+			return nil, false, httpError{err, http.StatusBadRequest}
+		}
+
+		if len(payloads) == 0 {
+			return nil, false, errBatchEmpty
+		}
+
+		if len(payloads) > maxBatch {
+			return nil, false, errBatchTooLarge
+		}
+
+		return payloads, true, nil
+	}
+
+	payloads = make([]apollows.PayloadOperation, 1)
+
+	err = json.Unmarshal(raw, &payloads[0])
+	if err != nil {
+		return nil, false, httpError{err, http.StatusBadRequest}
+	}
+
+	return payloads, false, nil
+}
+
+// readPayloadOperation decodes operation either from GET request query string or from JSON request body
+func readPayloadOperation(r *http.Request, payload *apollows.PayloadOperation) (err error) {
+	if r.Method != http.MethodGet {
+		err = checkPayloadContentType(r)
+		if err != nil {
+			return err
+		}
+
+		err = json.NewDecoder(r.Body).Decode(payload)
+		if err != nil {
+			return httpError{err, http.StatusBadRequest}
+		}
+
+		return nil
+	}
+
+	query := r.URL.Query()
+
+	payload.Query = query.Get("query")
+	payload.OperationName = query.Get("operationName")
+
+	if v := query.Get("variables"); v != "" {
+		err = json.Unmarshal([]byte(v), &payload.Variables)
+		if err != nil {
+			return httpError{err, http.StatusBadRequest}
+		}
+	}
+
+	if v := query.Get("extensions"); v != "" {
+		err = json.Unmarshal([]byte(v), &payload.Extensions)
+		if err != nil {
+			return httpError{err, http.StatusBadRequest}
+		}
+	}
+
+	return nil
+}
+
+// negotiateMediaType returns most preferred supported media type acceptable per Accept header, wildcards are matched
+// with fallback media type
+func negotiateMediaType(header http.Header, supported []string, fallback string) (best string, ok bool) {
+	values := header.Values("accept")
+	if len(values) == 0 {
+		return fallback, true
+	}
+
+	var (
+		bestq        float64
+		bestExplicit bool
+		bestIndex    int
+	)
+
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+
+			q := 1.0
+
+			if v, has := params["q"]; has {
+				q, err = strconv.ParseFloat(v, 64)
+				if err != nil || q <= 0 {
+					continue
+				}
+			}
+
+			candidate, explicit := mt, true
+
+			if mt == "*/*" || (strings.HasSuffix(mt, "/*") && strings.HasPrefix(fallback, strings.TrimSuffix(mt, "*"))) {
+				candidate, explicit = fallback, false
+			}
+
+			index := -1
+
+			for i, smt := range supported {
+				if smt == candidate {
+					index = i
+
+					break
+				}
+			}
+
+			if index < 0 {
+				continue
+			}
+
+			better := q > bestq ||
+				(q == bestq && explicit && !bestExplicit) ||
+				(q == bestq && explicit == bestExplicit && index < bestIndex)
+
+			if !ok || better {
+				best, bestq, bestExplicit, bestIndex, ok = candidate, q, explicit, index, true
+			}
+		}
+	}
+
+	return best, ok
+}
+
+// operationDefinition returns operation definition to be executed, as selected by operation name
+func operationDefinition(astdoc *ast.Document, operationName string) *ast.OperationDefinition {
+	for _, definition := range astdoc.Definitions {
+		op, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+
+		if operationName == "" || (op.Name != nil && op.Name.Value == operationName) {
+			return op
+		}
+	}
+
+	return nil
+}
+
 func (server *serverImpl) servePlainRequest(
 	reqctx mutable.Context,
 	w http.ResponseWriter,
@@ -29,22 +265,52 @@ func (server *serverImpl) servePlainRequest(
 		return errHTTPQueryRejected
 	}
 
+	mediaType, ok := negotiateMediaType(r.Header, plainMediaTypes, mediaTypeJSON)
+	multipart := multipartAccepted(r.Header)
+
+	if !ok && !multipart.accepted {
+		return errNotAcceptable
+	}
+
+	if ok {
+		reqctx.Set(contextKeyHTTPResponseMediaType, mediaType)
+	}
+
 	err = server.callbacks.OnConnect(reqctx, nil)
 	if err != nil {
 		return
 	}
 
-	var payload apollows.PayloadOperation
+	payloads, batch, err := readPayloadOperations(r, server.maxBatchSize)
+	if err != nil {
+		return
+	}
+
+	if batch {
+		if !ok {
+			return errNotAcceptable
+		}
+
+		return server.servePlainBatch(reqctx, w, payloads)
+	}
+
+	payload := payloads[0]
 
 	opctx := mutable.NewMutableContext(reqctx)
 
+	opctx.Set(ContextKeyOperationContext, opctx)
+
 	defer opctx.Cancel()
 
-	err = json.NewDecoder(r.Body).Decode(&payload)
+	err = server.takeHTTPRateLimit(opctx, w)
 	if err != nil {
 		return
 	}
 
+	if payload.Query == "" && !hasPersistedQuery(&payload) {
+		return errQueryRequired
+	}
+
 	defer func() {
 		err = server.callbacks.OnOperationDone(opctx, &payload, err)
 	}()
@@ -54,6 +320,11 @@ func (server *serverImpl) servePlainRequest(
 		return err
 	}
 
+	err = server.loadPersistedQuery(opctx, &payload)
+	if err != nil {
+		return err
+	}
+
 	params, astdoc, subscription, result := server.parseAST(opctx, &payload)
 
 	err = server.callbacks.OnOperationValidation(opctx, &payload, result)
@@ -62,46 +333,66 @@ func (server *serverImpl) servePlainRequest(
 	}
 
 	if result != nil {
-		return resultError{Result: result}
+		statusCode := http.StatusOK
+
+		// per GraphQL over HTTP spec, application/json responses use 200 for every well-formed request
+		if mediaType == mediaTypeGraphQLResponseJSON {
+			statusCode = http.StatusBadRequest
+		}
+
+		return resultError{Result: result, statusCode: statusCode}
 	}
 
-	w.Header().Set("content-type", "application/json")
+	if r.Method == http.MethodGet {
+		op := operationDefinition(astdoc, payload.OperationName)
+		if op != nil && op.Operation == ast.OperationTypeMutation {
+			w.Header().Set("allow", http.MethodPost)
 
-	var (
-		cres    chan *graphql.Result
-		flusher http.Flusher
-	)
+			return errMutationOverGET
+		}
+	}
+
+	err = server.registerPersistedQuery(opctx)
+	if err != nil {
+		return err
+	}
+
+	// subscriptions are delivered incrementally if client supports it, as are any results if JSON is not accepted
+	if multipart.accepted && (subscription || !ok) {
+		return server.serveMultipart(
+			reqctx,
+			opctx,
+			&payload,
+			params,
+			server.execute(params, astdoc, subscription),
+			w,
+			multipart,
+		)
+	}
+
+	w.Header().Set("content-type", mediaType+"; charset=utf-8")
+
+	var flusher http.Flusher
 
 	if subscription {
+		if !server.registerStream(reqctx) {
+			return errServerClosed
+		}
+
+		defer server.unregisterStream(reqctx)
+
 		flusher, _ = w.(http.Flusher)
 		w.Header().Set("x-content-type-options", "nosniff")
 		w.Header().Set("connection", "keep-alive")
+	}
 
-		cres = graphql.ExecuteSubscription(graphql.ExecuteParams{
-			Schema:        server.schema,
-			Root:          server.rootObject,
-			AST:           astdoc,
-			OperationName: payload.OperationName,
-			Args:          payload.Variables,
-			Context:       params.Context,
-		})
-	} else {
-		cres = make(chan *graphql.Result, 1)
-		cres <- graphql.Execute(graphql.ExecuteParams{
-			Schema:        server.schema,
-			Root:          server.rootObject,
-			AST:           astdoc,
-			OperationName: payload.OperationName,
-			Args:          payload.Variables,
-			Context:       params.Context,
-		})
-		close(cres)
-	}
-
-	var ok bool
+	cres := server.execute(params, astdoc, subscription)
+	shutdownch := server.shutdownChannel(opctx)
 
 	for {
 		select {
+		case <-shutdownch:
+			return
 		case <-params.Context.Done():
 			return params.Context.Err()
 		case result, ok = <-cres:
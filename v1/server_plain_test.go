@@ -4,9 +4,18 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -120,3 +129,297 @@ func TestNewServerPlain(t *testing.T) {
 
 	assert.NoError(t, resp.Body.Close())
 }
+
+func testPlainRequest(
+	t *testing.T,
+	method, u, contentType, accept string,
+	body string,
+) (resp *http.Response, pd apollows.PayloadDataResponse) {
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+
+	assert.NoError(t, err)
+
+	if contentType != "" {
+		req.Header.Set("content-type", contentType)
+	}
+
+	if accept != "" {
+		req.Header.Set("accept", accept)
+	}
+
+	resp, err = http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	if strings.Contains(resp.Header.Get("content-type"), "json") {
+		assert.NoError(t, json.Unmarshal(bs, &pd))
+	}
+
+	return resp, pd
+}
+
+func TestNewServerPlainGET(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS)
+
+	defer srv.Close()
+
+	resp, pd := testPlainRequest(t, http.MethodGet, srv.URL+"?"+url.Values{
+		"query":         []string{`query Foo { getFoo }`},
+		"operationName": []string{"Foo"},
+		"variables":     []string{`{}`},
+	}.Encode(), "", "", "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	resp, pd = testPlainRequest(t, http.MethodGet, srv.URL+"?"+url.Values{
+		"query": []string{`mutation { setFoo(value: 1) }`},
+	}.Encode(), "", "", "")
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	assert.Equal(t, http.MethodPost, resp.Header.Get("allow"))
+	assert.Len(t, pd.Errors, 1)
+
+	resp, _ = testPlainRequest(t, http.MethodGet, srv.URL+"?"+url.Values{
+		"query":     []string{`query { getFoo }`},
+		"variables": []string{`foo`},
+	}.Encode(), "", "", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, pd = testPlainRequest(t, http.MethodGet, srv.URL, "", "", "")
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, pd.Errors, 1)
+}
+
+func TestNewServerPlainMediaTypes(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS)
+
+	defer srv.Close()
+
+	resp, pd := testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/graphql-response+json, application/json;q=0.9",
+		`{"query":"query { getFoo }"}`,
+	)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/graphql-response+json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	resp, pd = testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		"application/graphql-response+json",
+		`{"query":"query { bar }"}`,
+	)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "application/graphql-response+json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.Greater(t, len(pd.Errors), 0)
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "*/*", `{"query":"query { bar }"}`)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.Greater(t, len(pd.Errors), 0)
+
+	body := `{"query":"query { getFoo }"}`
+
+	resp, _ = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "text/html", body)
+
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	resp, _ = testPlainRequest(t, http.MethodPost, srv.URL, "text/plain", "", `{"query":"query { getFoo }"}`)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, pd = testPlainRequest(t, http.MethodPost, srv.URL, "application/json", "", `{"query":`)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.Len(t, pd.Errors, 1)
+}
+
+func TestNegotiateMediaType(t *testing.T) {
+	for _, c := range []struct {
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"", mediaTypeJSON, true},
+		{"*/*", mediaTypeJSON, true},
+		{"application/*", mediaTypeJSON, true},
+		{"application/json", mediaTypeJSON, true},
+		{"application/graphql-response+json", mediaTypeGraphQLResponseJSON, true},
+		{"application/json, application/graphql-response+json", mediaTypeGraphQLResponseJSON, true},
+		{"application/json, application/graphql-response+json;q=0.5", mediaTypeJSON, true},
+		{"*/*, application/graphql-response+json", mediaTypeGraphQLResponseJSON, true},
+		{"text/html, application/json;q=0", "", false},
+	} {
+		header := make(http.Header)
+
+		if c.accept != "" {
+			header.Set("accept", c.accept)
+		}
+
+		mt, ok := negotiateMediaType(header, plainMediaTypes, mediaTypeJSON)
+
+		assert.Equal(t, c.ok, ok, c.accept)
+		assert.Equal(t, c.expected, mt, c.accept)
+	}
+}
+
+func testReadMultipart(t *testing.T, resp *http.Response) (parts []string) {
+	mt, params, err := mime.ParseMediaType(resp.Header.Get("content-type"))
+
+	assert.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mt)
+	assert.Equal(t, "-", params["boundary"])
+
+	rd := multipart.NewReader(resp.Body, params["boundary"])
+
+	for {
+		part, err := rd.NextPart()
+		if err == io.EOF {
+			break
+		}
+
+		assert.NoError(t, err)
+
+		if err != nil {
+			break
+		}
+
+		assert.Equal(t, "application/json; charset=utf-8", part.Header.Get("content-type"))
+
+		bs, err := ioutil.ReadAll(part)
+
+		assert.NoError(t, err)
+
+		parts = append(parts, string(bs))
+	}
+
+	return parts
+}
+
+func TestNewServerPlainMultipart(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS)
+
+	defer srv.Close()
+
+	body := `{"query":"subscription { fooUpdates }"}`
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("accept", `multipart/mixed;boundary="-";deferSpec=20220824, application/json`)
+
+	resp, err := http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{
+		`{"data":{"fooUpdates":1}}`,
+		`{"data":{"fooUpdates":2}}`,
+		`{"data":{"fooUpdates":3}}`,
+	}, testReadMultipart(t, resp))
+	assert.NoError(t, resp.Body.Close())
+
+	req, err = http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("accept", `multipart/mixed;boundary="graphql";subscriptionSpec=1.0, application/json`)
+
+	resp, err = http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"payload":{"data":{"fooUpdates":1}}}`,
+		`{"payload":{"data":{"fooUpdates":2}}}`,
+		`{"payload":{"data":{"fooUpdates":3}}}`,
+	}, testReadMultipart(t, resp))
+	assert.NoError(t, resp.Body.Close())
+
+	resp, pd := testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL,
+		"application/json",
+		`multipart/mixed, application/json`,
+		`{"query":"query { getFoo }"}`,
+	)
+
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("content-type"))
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+}
+
+func TestNewServerPlainMultipartHeartbeat(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithKeepalive(time.Millisecond*10))
+
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"query":"subscription { forever }"}`))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("accept", `multipart/mixed`)
+
+	resp, err := http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("content-type"))
+
+	assert.NoError(t, err)
+
+	part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+
+	assert.NoError(t, err)
+
+	bs, err := ioutil.ReadAll(part)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(bs))
+	assert.NoError(t, resp.Body.Close())
+}
+
+func TestNewServerPlainMultipartCancelled(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithCallbacks(Callbacks{
+		OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+			time.AfterFunc(time.Millisecond*20, opctx.Cancel)
+
+			return nil
+		},
+	}))
+
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"query":"subscription { forever }"}`))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("accept", `multipart/mixed`)
+
+	resp, err := http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+	assert.Empty(t, testReadMultipart(t, resp))
+	assert.NoError(t, resp.Body.Close())
+}
@@ -0,0 +1,205 @@
+package wsgraphql
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+)
+
+// ErrServerClosed returned for requests and operations received after Shutdown was called
+var ErrServerClosed = errors.New("server closed")
+
+var errServerClosed = httpError{ErrServerClosed, http.StatusServiceUnavailable}
+
+// connections tracks active websocket connections and streamed HTTP responses, to be drained on shutdown
+type connections struct {
+	requests map[*websocketRequest]struct{}
+	streams  map[mutable.Context]struct{}
+	shutdown chan struct{}
+	seq      uint64
+	once     sync.Once
+	wg       sync.WaitGroup
+	m        sync.Mutex
+}
+
+func (server *serverImpl) isShutdown() bool {
+	select {
+	case <-server.connections.shutdown:
+		return true
+	default:
+		return false
+	}
+}
+
+// register adds websocket connection to the set of active connections, returns false if server is shutting down
+func (server *serverImpl) register(req *websocketRequest) bool {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	if server.isShutdown() {
+		return false
+	}
+
+	server.connections.seq++
+
+	req.id = strconv.FormatUint(server.connections.seq, 10)
+	req.ctx.Set(ContextKeyConnectionID, req.id)
+	req.ctx.Set(contextKeyWebsocketRequest, req)
+
+	server.connections.requests[req] = struct{}{}
+	server.connections.wg.Add(1)
+
+	return true
+}
+
+func (server *serverImpl) unregister(req *websocketRequest) {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	delete(server.connections.requests, req)
+	server.connections.wg.Done()
+}
+
+// registerStream adds streamed HTTP response, such as SSE stream or multipart subscription, to the set of active
+// connections, returns false if server is shutting down
+func (server *serverImpl) registerStream(reqctx mutable.Context) bool {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	if server.isShutdown() {
+		return false
+	}
+
+	server.connections.streams[reqctx] = struct{}{}
+	server.connections.wg.Add(1)
+
+	return true
+}
+
+func (server *serverImpl) unregisterStream(reqctx mutable.Context) {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	delete(server.connections.streams, reqctx)
+	server.connections.wg.Done()
+}
+
+// shutdownChannel returns channel closed on shutdown for subscriptions, which are completed then, or nil otherwise
+func (server *serverImpl) shutdownChannel(opctx mutable.Context) <-chan struct{} {
+	if !ContextSubscription(opctx) {
+		return nil
+	}
+
+	return server.connections.shutdown
+}
+
+func (server *serverImpl) activeRequests() (reqs []*websocketRequest) {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	for req := range server.connections.requests {
+		reqs = append(reqs, req)
+	}
+
+	return reqs
+}
+
+func (server *serverImpl) activeStreams() (streams []mutable.Context) {
+	server.connections.m.Lock()
+	defer server.connections.m.Unlock()
+
+	for reqctx := range server.connections.streams {
+		streams = append(streams, reqctx)
+	}
+
+	return streams
+}
+
+// Shutdown gracefully shuts down the server: new requests and websocket operations are rejected with
+// ErrServerClosed, running queries and mutations are awaited, subscriptions are completed, after which websocket
+// connections are closed with code configured by WithShutdownCloseCode. Streamed HTTP responses (SSE streams,
+// multipart and streamed plain subscriptions) are tracked the same way and end once their operations are done.
+// If provided context is done before all connections are closed, remaining operations are cancelled, connections are
+// closed and context error is returned.
+// Other plain HTTP requests in progress are not tracked, use http.Server.Shutdown to await them.
+func (server *serverImpl) Shutdown(ctx context.Context) error {
+	server.connections.once.Do(func() {
+		server.connections.m.Lock()
+		close(server.connections.shutdown)
+		server.connections.m.Unlock()
+	})
+
+	for _, req := range server.activeRequests() {
+		req.drain()
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		server.connections.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	for _, req := range server.activeRequests() {
+		req.ctx.Cancel()
+
+		_ = req.ws.Close(req.protocol.CloseCode(server.shutdownCloseCode), server.shutdownCloseCode.Error())
+	}
+
+	for _, reqctx := range server.activeStreams() {
+		reqctx.Cancel()
+	}
+
+	return ctx.Err()
+}
+
+// drain prevents new operations from starting and schedules connection close once running operations are done
+func (req *websocketRequest) drain() {
+	req.m.Lock()
+	defer req.m.Unlock()
+
+	req.draining = true
+
+	if len(req.operations) == 0 {
+		req.drainedOnce.Do(func() {
+			close(req.drained)
+		})
+	}
+}
+
+// closeDrained closes the connection with shutdown code, flushing already queued messages first
+func (req *websocketRequest) closeDrained() error {
+	var code apollows.Error = req.server.shutdownCloseCode
+
+	for {
+		select {
+		case msg, ok := <-req.outgoing:
+			switch {
+			case !ok:
+			case msg.Message != nil:
+				err := req.ws.WriteJSON(msg.Message)
+				if err != nil {
+					return err
+				}
+
+				continue
+			case msg.Error != nil:
+				code = msg.Error
+			}
+		default:
+		}
+
+		return req.ws.Close(req.protocol.CloseCode(code), code.Error())
+	}
+}
@@ -0,0 +1,259 @@
+package wsgraphql
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func testConnectGTWS(t *testing.T, srv *httptest.Server) *websocket.Conn {
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	_ = resp.Body.Close()
+
+	err = conn.WriteJSON(apollows.Message{
+		Type:    apollows.OperationConnectionInit,
+		Payload: apollows.Data{},
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationConnectionAck, msg.Type)
+
+	return conn
+}
+
+func TestServerShutdown(t *testing.T) {
+	started := make(chan struct{}, 1)
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithShutdownCloseCode(apollows.EventServiceRestart),
+		WithCallbacks(Callbacks{
+			OnOperation: func(ctx mutable.Context, payload *apollows.PayloadOperation) error {
+				started <- struct{}{}
+
+				return nil
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err = conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { forever }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	<-started
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- server.Shutdown(context.Background())
+	}()
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationComplete, msg.Type)
+	assert.Equal(t, "1", msg.ID)
+
+	err = conn.ReadJSON(&msg)
+
+	assert.ErrorContains(t, err, "1012: Service restart")
+	assert.NoError(t, <-done)
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"query":"query { getFoo }"}`))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	_ = resp.Body.Close()
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	started := make(chan struct{}, 1)
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithCallbacks(Callbacks{
+			OnOperation: func(ctx mutable.Context, payload *apollows.PayloadOperation) error {
+				started <- struct{}{}
+
+				<-ctx.Done()
+
+				return ctx.Err()
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err = conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `query { getFoo }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var msg apollows.Message
+
+	// operation error caused by cancellation may precede close message
+	for {
+		err = conn.ReadJSON(&msg)
+		if err != nil {
+			break
+		}
+	}
+
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+func TestServerShutdownStreams(t *testing.T) {
+	server, err := NewServer(testNewSchema(t))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	op := apollows.PayloadOperation{
+		Query: `subscription { forever }`,
+	}
+
+	distinct := testSSERequest(t, http.MethodPost, srv.URL, op, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	defer func() {
+		_ = distinct.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, distinct.StatusCode)
+
+	mp := testSSERequest(t, http.MethodPost, srv.URL, op, http.Header{
+		"Accept": []string{`multipart/mixed;boundary="-";subscriptionSpec=1.0`},
+	})
+
+	defer func() {
+		_ = mp.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, mp.StatusCode)
+
+	resp := testSSERequest(t, http.MethodPut, srv.URL, nil, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	token := string(bs)
+
+	stream := testSSERequest(t, http.MethodGet, srv.URL, nil, http.Header{
+		"Accept":             []string{"text/event-stream"},
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	defer func() {
+		_ = stream.Body.Close()
+	}()
+
+	op.Extensions = map[string]interface{}{
+		"operationId": "1",
+	}
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, op, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+
+	defer cancel()
+
+	assert.NoError(t, server.Shutdown(ctx))
+
+	// subscriptions are completed and responses are terminated
+	assert.Equal(t, "complete", testReadSSEEvent(t, bufio.NewScanner(distinct.Body)).event)
+	assert.Empty(t, testReadMultipart(t, mp))
+
+	scanner := bufio.NewScanner(stream.Body)
+
+	ev := testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "complete", ev.event)
+	assert.JSONEq(t, `{"id":"1"}`, ev.data)
+	assert.False(t, scanner.Scan())
+}
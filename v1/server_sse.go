@@ -0,0 +1,662 @@
+package wsgraphql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	// DefaultSSEReservationTimeout is duration single connection mode stream reservation is kept for by default
+	DefaultSSEReservationTimeout = time.Second * 30
+
+	// DefaultMaxSSEReservations is maximum number of stream reservations pending connection by default
+	DefaultMaxSSEReservations = 1024
+
+	// SSEStreamTokenHeader HTTP header used by graphql-sse clients to pass single connection mode stream token
+	SSEStreamTokenHeader = "X-GraphQL-Event-Stream-Token"
+
+	sseTokenParam       = "token"
+	sseOperationIDParam = "operationId"
+	sseOperationIDExt   = "operationId"
+	sseEventNext        = "next"
+	sseEventComplete    = "complete"
+	sseMediaType        = "text/event-stream"
+)
+
+var (
+	errSSEStreamNotFound      = httpError{errors.New("event stream not found"), http.StatusNotFound}
+	errSSEStreamConnected     = httpError{errors.New("event stream already connected"), http.StatusConflict}
+	errSSEStreamNotConnected  = httpError{errors.New("event stream not connected"), http.StatusConflict}
+	errSSEOperationID         = httpError{errors.New("operation id is required"), http.StatusBadRequest}
+	errSSEOperationExists     = httpError{errors.New("operation with provided id already exists"), http.StatusConflict}
+	errSSEMethodNotAllowed    = httpError{errors.New("method not allowed"), http.StatusMethodNotAllowed}
+	errSSETooManyReservations = httpError{errors.New("too many event stream reservations"), http.StatusServiceUnavailable}
+)
+
+type sseEvent struct {
+	event string
+	data  interface{}
+}
+
+type sseOperationData struct {
+	Payload interface{} `json:"payload,omitempty"`
+	ID      string      `json:"id"`
+}
+
+type sseStream struct {
+	ctx        mutable.Context
+	events     chan sseEvent
+	operations map[string]mutable.Context
+	token      string
+	wg         sync.WaitGroup
+	m          sync.Mutex
+	closed     bool
+	expired    bool
+}
+
+type sseStreams struct {
+	streams map[string]*sseStream
+	pending int
+	m       sync.Mutex
+}
+
+// isSSERequest reports whether request targets graphql-sse: reservations and token query parameter are only recognized
+// on path set with WithSSEPath, as they are indistinguishable from plain requests otherwise
+func (server *serverImpl) isSSERequest(r *http.Request) bool {
+	if server.rejectSSE {
+		return false
+	}
+
+	if server.ssePath != "" {
+		return r.URL.Path == server.ssePath &&
+			(isSSEReservation(r) || server.sseToken(r) != "" || headerContainsMediaType(r.Header, "accept", sseMediaType))
+	}
+
+	return r.Header.Get(SSEStreamTokenHeader) != "" || headerContainsMediaType(r.Header, "accept", sseMediaType)
+}
+
+// isSSEReservation reports whether request is a single connection mode stream reservation, which has no body
+func isSSEReservation(r *http.Request) bool {
+	return r.Method == http.MethodPut && r.ContentLength == 0
+}
+
+func (server *serverImpl) sseToken(r *http.Request) string {
+	token := r.Header.Get(SSEStreamTokenHeader)
+	if token == "" && server.ssePath != "" {
+		token = r.URL.Query().Get(sseTokenParam)
+	}
+
+	return token
+}
+
+func (server *serverImpl) serveSSERequest(
+	reqctx mutable.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+	if server.rejectHTTPQueries {
+		return errHTTPQueryRejected
+	}
+
+	token := server.sseToken(r)
+
+	switch {
+	case isSSEReservation(r):
+		return server.serveSSEReservation(w)
+	case token == "":
+		return server.serveSSEDistinct(reqctx, w, r)
+	case r.Method == http.MethodGet:
+		return server.serveSSEStream(reqctx, token, w)
+	case r.Method == http.MethodPost:
+		return server.serveSSEOperation(reqctx, token, w, r)
+	case r.Method == http.MethodDelete:
+		return server.serveSSEStop(token, w, r)
+	default:
+		return errSSEMethodNotAllowed
+	}
+}
+
+func (server *serverImpl) serveSSEReservation(w http.ResponseWriter) (err error) {
+	bs := make([]byte, 16)
+
+	_, err = rand.Read(bs)
+	if err != nil {
+		return
+	}
+
+	stream := &sseStream{
+		token:      hex.EncodeToString(bs),
+		events:     make(chan sseEvent, 1),
+		operations: make(map[string]mutable.Context),
+	}
+
+	server.sse.m.Lock()
+
+	if server.sse.pending >= server.maxSSEReservations {
+		server.sse.m.Unlock()
+
+		return errSSETooManyReservations
+	}
+
+	server.sse.streams[stream.token] = stream
+	server.sse.pending++
+
+	server.sse.m.Unlock()
+
+	time.AfterFunc(server.sseReservationTimeout, func() {
+		stream.m.Lock()
+		defer stream.m.Unlock()
+
+		if stream.ctx == nil {
+			stream.expired = true
+
+			server.sse.m.Lock()
+			delete(server.sse.streams, stream.token)
+			server.sse.pending--
+			server.sse.m.Unlock()
+		}
+	})
+
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusCreated)
+
+	_, err = w.Write([]byte(stream.token))
+
+	return
+}
+
+func (server *serverImpl) getSSEStream(token string) (*sseStream, error) {
+	server.sse.m.Lock()
+	stream, ok := server.sse.streams[token]
+	server.sse.m.Unlock()
+
+	if !ok {
+		return nil, errSSEStreamNotFound
+	}
+
+	return stream, nil
+}
+
+func (server *serverImpl) removeSSEStream(stream *sseStream) {
+	server.sse.m.Lock()
+	delete(server.sse.streams, stream.token)
+	server.sse.m.Unlock()
+}
+
+func (server *serverImpl) serveSSEStream(reqctx mutable.Context, token string, w http.ResponseWriter) (err error) {
+	stream, err := server.getSSEStream(token)
+	if err != nil {
+		return
+	}
+
+	stream.m.Lock()
+
+	switch {
+	case stream.expired:
+		stream.m.Unlock()
+
+		return errSSEStreamNotFound
+	case stream.ctx != nil:
+		stream.m.Unlock()
+
+		return errSSEStreamConnected
+	}
+
+	stream.ctx = reqctx
+
+	server.sse.m.Lock()
+	server.sse.pending--
+	server.sse.m.Unlock()
+
+	stream.m.Unlock()
+
+	defer server.removeSSEStream(stream)
+
+	err = server.callbacks.OnConnect(reqctx, nil)
+	if err != nil {
+		return
+	}
+
+	if !server.registerStream(reqctx) {
+		return errServerClosed
+	}
+
+	defer server.unregisterStream(reqctx)
+
+	flusher := server.writeSSEHeaders(reqctx, w)
+
+	go func() {
+		// on shutdown, stream ends once running operations are done, subscriptions are completed
+		select {
+		case <-reqctx.Done():
+		case <-server.connections.shutdown:
+		}
+
+		stream.m.Lock()
+		stream.closed = true
+		stream.m.Unlock()
+
+		// await for all operations to complete, so nothing will write to stream.events from this point
+		stream.wg.Wait()
+
+		close(stream.events)
+	}()
+
+	var tickerch <-chan time.Time
+
+	if server.keepalive > 0 {
+		ticker := time.NewTicker(server.keepalive)
+
+		defer ticker.Stop()
+
+		tickerch = ticker.C
+	}
+
+	// stream.events is read to completion to avoid any potential blocking
+	for {
+		select {
+		case ev, ok := <-stream.events:
+			if !ok {
+				return
+			}
+
+			if err == nil {
+				err = writeSSEEvent(w, flusher, ev.event, ev.data)
+			}
+		case <-tickerch:
+			if err == nil {
+				err = writeSSEKeepalive(w, flusher)
+			}
+		}
+
+		if err != nil {
+			reqctx.Cancel()
+		}
+	}
+}
+
+func (server *serverImpl) serveSSEOperation(
+	reqctx mutable.Context,
+	token string,
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+	stream, err := server.getSSEStream(token)
+	if err != nil {
+		return
+	}
+
+	stream.m.Lock()
+	streamctx, closed := stream.ctx, stream.closed
+	stream.m.Unlock()
+
+	switch {
+	case closed:
+		return errSSEStreamNotFound
+	case streamctx == nil:
+		return errSSEStreamNotConnected
+	}
+
+	var payload apollows.PayloadOperation
+
+	err = readPayloadOperation(r, &payload)
+	if err != nil {
+		return
+	}
+
+	id, _ := payload.Extensions[sseOperationIDExt].(string)
+	if id == "" {
+		return errSSEOperationID
+	}
+
+	opctx := mutable.NewMutableContext(streamctx)
+
+	opctx.Set(ContextKeyOperationContext, opctx)
+	opctx.Set(ContextKeyOperationID, id)
+
+	err = server.takeHTTPRateLimit(opctx, w)
+	if err != nil {
+		opctx.Cancel()
+
+		return
+	}
+
+	stream.m.Lock()
+
+	_, exists := stream.operations[id]
+	if !exists && !stream.closed {
+		stream.operations[id] = opctx
+		stream.wg.Add(1)
+	}
+
+	closed = stream.closed
+
+	stream.m.Unlock()
+
+	switch {
+	case closed:
+		return errSSEStreamNotFound
+	case exists:
+		return errSSEOperationExists
+	}
+
+	params, cres, err := server.prepareSSEOperation(opctx, &payload)
+	if err != nil {
+		err = server.callbacks.OnOperationDone(opctx, &payload, err)
+
+		stream.removeOperation(opctx)
+
+		return
+	}
+
+	go func() {
+		operr := server.runSSEOperation(stream, opctx, params.Context, &payload, cres)
+
+		server.finishSSEOperation(stream, opctx, &payload, operr)
+	}()
+
+	reqctx.Set(ContextKeyHTTPResponseStarted, true)
+
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
+func (server *serverImpl) prepareSSEOperation(
+	opctx mutable.Context,
+	payload *apollows.PayloadOperation,
+) (params graphql.Params, cres chan *graphql.Result, err error) {
+	err = server.callbacks.OnOperation(opctx, payload)
+	if err != nil {
+		return
+	}
+
+	err = server.loadPersistedQuery(opctx, payload)
+	if err != nil {
+		return
+	}
+
+	params, astdoc, subscription, result := server.parseAST(opctx, payload)
+
+	err = server.callbacks.OnOperationValidation(opctx, payload, result)
+	if err != nil {
+		return
+	}
+
+	if result != nil {
+		err = resultError{Result: result}
+
+		return
+	}
+
+	err = server.registerPersistedQuery(opctx)
+	if err != nil {
+		return
+	}
+
+	return params, server.execute(params, astdoc, subscription), nil
+}
+
+func (server *serverImpl) runSSEOperation(
+	stream *sseStream,
+	opctx mutable.Context,
+	ctx context.Context,
+	payload *apollows.PayloadOperation,
+	cres chan *graphql.Result,
+) (err error) {
+	id := ContextOperationID(opctx)
+	shutdownch := server.shutdownChannel(opctx)
+
+	for {
+		select {
+		case <-shutdownch:
+			return
+		case <-ctx.Done():
+			return
+		case result, ok := <-cres:
+			if !ok {
+				return
+			}
+
+			err = server.callbacks.OnOperationResult(opctx, payload, result)
+			if err != nil {
+				return
+			}
+
+			stream.send(sseEvent{
+				event: sseEventNext,
+				data: sseOperationData{
+					ID:      id,
+					Payload: result,
+				},
+			})
+		}
+	}
+}
+
+func (server *serverImpl) finishSSEOperation(
+	stream *sseStream,
+	opctx mutable.Context,
+	payload *apollows.PayloadOperation,
+	err error,
+) {
+	id := ContextOperationID(opctx)
+
+	err = server.callbacks.OnOperationDone(opctx, payload, err)
+
+	if !ContextOperationStopped(opctx) {
+		if err != nil {
+			stream.send(sseEvent{
+				event: sseEventNext,
+				data: sseOperationData{
+					ID:      id,
+					Payload: toResultError(err).Result,
+				},
+			})
+		}
+
+		stream.send(sseEvent{
+			event: sseEventComplete,
+			data: sseOperationData{
+				ID: id,
+			},
+		})
+	}
+
+	stream.removeOperation(opctx)
+}
+
+func (stream *sseStream) removeOperation(opctx mutable.Context) {
+	opctx.Cancel()
+
+	stream.m.Lock()
+	delete(stream.operations, ContextOperationID(opctx))
+	stream.m.Unlock()
+
+	stream.wg.Done()
+}
+
+func (stream *sseStream) send(ev sseEvent) {
+	select {
+	case stream.events <- ev:
+	case <-stream.ctx.Done():
+	}
+}
+
+func (server *serverImpl) serveSSEStop(token string, w http.ResponseWriter, r *http.Request) (err error) {
+	stream, err := server.getSSEStream(token)
+	if err != nil {
+		return
+	}
+
+	id := r.URL.Query().Get(sseOperationIDParam)
+	if id == "" {
+		return errSSEOperationID
+	}
+
+	stream.m.Lock()
+	opctx, ok := stream.operations[id]
+	stream.m.Unlock()
+
+	if ok {
+		opctx.Set(ContextKeyOperationStopped, true)
+		opctx.Cancel()
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	return nil
+}
+
+func (server *serverImpl) serveSSEDistinct(
+	reqctx mutable.Context,
+	w http.ResponseWriter,
+	r *http.Request,
+) (err error) {
+	err = server.callbacks.OnConnect(reqctx, nil)
+	if err != nil {
+		return
+	}
+
+	var payload apollows.PayloadOperation
+
+	opctx := mutable.NewMutableContext(reqctx)
+
+	opctx.Set(ContextKeyOperationContext, opctx)
+
+	defer opctx.Cancel()
+
+	err = readPayloadOperation(r, &payload)
+	if err != nil {
+		return
+	}
+
+	err = server.takeHTTPRateLimit(opctx, w)
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		err = server.callbacks.OnOperationDone(opctx, &payload, err)
+	}()
+
+	params, cres, err := server.prepareSSEOperation(opctx, &payload)
+	if err != nil {
+		return
+	}
+
+	if !server.registerStream(reqctx) {
+		return errServerClosed
+	}
+
+	defer server.unregisterStream(reqctx)
+
+	flusher := server.writeSSEHeaders(reqctx, w)
+
+	var tickerch <-chan time.Time
+
+	if server.keepalive > 0 {
+		ticker := time.NewTicker(server.keepalive)
+
+		defer ticker.Stop()
+
+		tickerch = ticker.C
+	}
+
+	shutdownch := server.shutdownChannel(opctx)
+
+	for {
+		select {
+		case <-shutdownch:
+			return writeSSEEvent(w, flusher, sseEventComplete, nil)
+		case <-params.Context.Done():
+			return params.Context.Err()
+		case <-tickerch:
+			err = writeSSEKeepalive(w, flusher)
+		case result, ok := <-cres:
+			if !ok {
+				return writeSSEEvent(w, flusher, sseEventComplete, nil)
+			}
+
+			err = server.callbacks.OnOperationResult(opctx, &payload, result)
+			if err != nil {
+				return
+			}
+
+			err = writeSSEEvent(w, flusher, sseEventNext, result)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (server *serverImpl) writeSSEHeaders(reqctx mutable.Context, w http.ResponseWriter) http.Flusher {
+	w.Header().Set("content-type", sseMediaType+"; charset=utf-8")
+	w.Header().Set("cache-control", "no-cache")
+	w.Header().Set("connection", "keep-alive")
+	w.Header().Set("x-accel-buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	reqctx.Set(ContextKeyHTTPResponseStarted, true)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return flusher
+}
+
+func writeSSEEvent(w http.ResponseWriter, flusher http.Flusher, event string, data interface{}) (err error) {
+	bs := []byte("event: " + event + "\ndata:")
+
+	if data != nil {
+		var dbs []byte
+
+		dbs, err = json.Marshal(data)
+		if err != nil {
+			return
+		}
+
+		bs = append(bs, ' ')
+		bs = append(bs, dbs...)
+	}
+
+	bs = append(bs, '\n', '\n')
+
+	_, err = w.Write(bs)
+	if err != nil {
+		return
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+func writeSSEKeepalive(w http.ResponseWriter, flusher http.Flusher) (err error) {
+	_, err = w.Write([]byte(":\n\n"))
+	if err != nil {
+		return
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return nil
+}
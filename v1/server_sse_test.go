@@ -0,0 +1,390 @@
+package wsgraphql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSSEEvent struct {
+	event string
+	data  string
+}
+
+func testReadSSEEvent(t *testing.T, scanner *bufio.Scanner) (ev testSSEEvent) {
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if ev.event != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "event:"):
+			ev.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			ev.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+
+	assert.NoError(t, scanner.Err())
+
+	return ev
+}
+
+func testSSERequest(t *testing.T, method, u string, body interface{}, header http.Header) *http.Response {
+	var rd io.Reader
+
+	if body != nil {
+		bs, err := json.Marshal(body)
+
+		assert.NoError(t, err)
+
+		rd = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequest(method, u, rd)
+
+	assert.NoError(t, err)
+
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+
+	return resp
+}
+
+func TestNewServerSSEDistinct(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer srv.Close()
+
+	header := http.Header{
+		"Accept": []string{"text/event-stream"},
+	}
+
+	resp := testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `subscription { fooUpdates }`,
+	}, header)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("content-type"), "text/event-stream")
+
+	scanner := bufio.NewScanner(resp.Body)
+
+	for idx := 1; idx <= 3; idx++ {
+		ev := testReadSSEEvent(t, scanner)
+
+		assert.Equal(t, "next", ev.event)
+
+		var pd apollows.PayloadDataResponse
+
+		assert.NoError(t, json.Unmarshal([]byte(ev.data), &pd))
+		assert.EqualValues(t, idx, pd.Data["fooUpdates"])
+	}
+
+	ev := testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "complete", ev.event)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodGet, srv.URL+"?query="+url.QueryEscape(`query { getFoo }`), nil, header)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	scanner = bufio.NewScanner(resp.Body)
+
+	ev = testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "next", ev.event)
+	assert.JSONEq(t, `{"data":{"getFoo":123}}`, ev.data)
+
+	ev = testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "complete", ev.event)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `query { bar }`,
+	}, header)
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.Contains(t, string(bs), `Cannot query field \"bar\"`)
+	assert.NoError(t, resp.Body.Close())
+}
+
+func TestNewServerSSESingleConnection(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS, WithConnectTimeout(time.Second))
+
+	defer srv.Close()
+
+	resp := testSSERequest(t, http.MethodPut, srv.URL, nil, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	token := string(bs)
+
+	assert.NotEmpty(t, token)
+
+	stream := testSSERequest(t, http.MethodGet, srv.URL, nil, http.Header{
+		"Accept":             []string{"text/event-stream"},
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	defer func() {
+		_ = stream.Body.Close()
+	}()
+
+	assert.Equal(t, http.StatusOK, stream.StatusCode)
+
+	resp = testSSERequest(t, http.MethodGet, srv.URL, nil, http.Header{
+		"Accept":             []string{"text/event-stream"},
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	scanner := bufio.NewScanner(stream.Body)
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `subscription { fooUpdates }`,
+		Extensions: map[string]interface{}{
+			"operationId": "1",
+		},
+	}, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	for idx := 1; idx <= 3; idx++ {
+		ev := testReadSSEEvent(t, scanner)
+
+		assert.Equal(t, "next", ev.event)
+
+		var msg struct {
+			Payload apollows.PayloadDataResponse `json:"payload"`
+			ID      string                       `json:"id"`
+		}
+
+		assert.NoError(t, json.Unmarshal([]byte(ev.data), &msg))
+		assert.Equal(t, "1", msg.ID)
+		assert.EqualValues(t, idx, msg.Payload.Data["fooUpdates"])
+	}
+
+	ev := testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "complete", ev.event)
+	assert.JSONEq(t, `{"id":"1"}`, ev.data)
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `subscription { forever }`,
+		Extensions: map[string]interface{}{
+			"operationId": "2",
+		},
+	}, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `subscription { forever }`,
+		Extensions: map[string]interface{}{
+			"operationId": "2",
+		},
+	}, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodDelete, srv.URL+"?operationId=2", nil, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+		Extensions: map[string]interface{}{
+			"operationId": "3",
+		},
+	}, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	ev = testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "next", ev.event)
+	assert.JSONEq(t, `{"id":"3","payload":{"data":{"getFoo":123}}}`, ev.data)
+
+	ev = testReadSSEEvent(t, scanner)
+
+	assert.Equal(t, "complete", ev.event)
+	assert.JSONEq(t, `{"id":"3"}`, ev.data)
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `query { bar }`,
+		Extensions: map[string]interface{}{
+			"operationId": "4",
+		},
+	}, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	}, http.Header{
+		SSEStreamTokenHeader: []string{token},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	}, http.Header{
+		SSEStreamTokenHeader: []string{"foo"},
+	})
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+}
+
+func TestNewServerWithoutSSE(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS, WithoutSSE())
+
+	defer srv.Close()
+
+	resp := testSSERequest(t, http.MethodPost, srv.URL, apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	}, http.Header{
+		"Accept": []string{"text/event-stream"},
+	})
+
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+}
+
+func TestNewServerSSEReservations(t *testing.T) {
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithSSEPath("/stream"),
+		WithSSEReservations(time.Millisecond*50, 1),
+	)
+
+	defer srv.Close()
+
+	resp := testSSERequest(t, http.MethodPut, srv.URL+"/stream", nil, nil)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	bs, err := ioutil.ReadAll(resp.Body)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPut, srv.URL+"/stream", nil, nil)
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	// requests to other paths and PUT requests with body are not reservations
+	resp = testSSERequest(t, http.MethodPut, srv.URL, nil, nil)
+
+	assert.NotEqual(t, http.StatusCreated, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPut, srv.URL+"/stream", apollows.PayloadOperation{
+		Query: `query { getFoo }`,
+	}, nil)
+
+	assert.NotEqual(t, http.StatusCreated, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	time.Sleep(time.Millisecond * 100)
+
+	resp = testSSERequest(t, http.MethodGet, srv.URL+"/stream", nil, http.Header{
+		"Accept":             []string{"text/event-stream"},
+		SSEStreamTokenHeader: []string{string(bs)},
+	})
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	resp = testSSERequest(t, http.MethodPut, srv.URL+"/stream", nil, nil)
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+}
+
+func TestNewServerSSETokenParamPlain(t *testing.T) {
+	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlTransportWS)
+
+	defer srv.Close()
+
+	// unrelated token query parameter does not select graphql-sse unless WithSSEPath is set
+	resp, pd := testPlainRequest(
+		t,
+		http.MethodGet,
+		srv.URL+"?token=abc&query="+url.QueryEscape(`query { getFoo }`),
+		"",
+		"application/json",
+		"",
+	)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, pd.Errors)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	resp, pd = testPlainRequest(
+		t,
+		http.MethodPost,
+		srv.URL+"?token=abc",
+		"application/json",
+		"application/json",
+		`{"query":"query { getFoo }"}`,
+	)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, pd.Errors)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+}
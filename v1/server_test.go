@@ -103,6 +103,23 @@ func testNewSchema(t *testing.T) graphql.Schema {
 						return ch, nil
 					},
 				},
+				"fooMany": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{}, 100)
+
+						for i := 1; i <= 100; i++ {
+							ch <- i
+						}
+
+						close(ch)
+
+						return ch, nil
+					},
+				},
 				"forever": &graphql.Field{
 					Type: graphql.Int,
 					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
@@ -1,9 +1,11 @@
 package wsgraphql
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
@@ -13,16 +15,68 @@ import (
 	"github.com/graphql-go/graphql/gqlerrors"
 )
 
+// ErrTooManyOperations returned for operations exceeding WithMaxOperationsPerConnection limit
+var ErrTooManyOperations = errors.New("too many operations")
+
+var errHijackUnsupported = errors.New("response writer does not support hijacking")
+
 type websocketRequest struct {
-	ctx        mutable.Context
-	outgoing   chan outgoingMessage
-	operations map[string]mutable.Context
-	ws         Conn
-	server     *serverImpl
-	protocol   apollows.Protocol
-	wg         sync.WaitGroup
-	m          sync.RWMutex
-	init       bool
+	ctx         mutable.Context
+	outgoing    chan outgoingMessage
+	pong        chan struct{}
+	drained     chan struct{}
+	closing     chan apollows.Error
+	operations  map[string]mutable.Context
+	initPayload apollows.PayloadInit
+	ws          Conn
+	server      *serverImpl
+	protocol    Protocol
+	id          string
+	wg          sync.WaitGroup
+	drainedOnce sync.Once
+	m           sync.RWMutex
+	init        bool
+	draining    bool
+}
+
+// upgradeResponseWriter records whether upgrader has written response, e.g. rejecting upgrade
+type upgradeResponseWriter struct {
+	http.ResponseWriter
+	written bool
+}
+
+func (w *upgradeResponseWriter) WriteHeader(statusCode int) {
+	w.written = true
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *upgradeResponseWriter) Write(bs []byte) (int, error) {
+	w.written = true
+
+	return w.ResponseWriter.Write(bs)
+}
+
+func (w *upgradeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errHijackUnsupported
+	}
+
+	w.written = true
+
+	return hj.Hijack()
+}
+
+func (w *upgradeResponseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// Unwrap allows http.ResponseController to reach underlying response writer
+func (w *upgradeResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 type outgoingMessage struct {
@@ -35,17 +89,31 @@ func (server *serverImpl) serveWebsocketRequest(
 	w http.ResponseWriter,
 	r *http.Request,
 ) (err error) {
-	ws, err := server.upgrader.Upgrade(w, r, nil)
+	uw := &upgradeResponseWriter{
+		ResponseWriter: w,
+	}
+
+	ws, err := server.upgrader.Upgrade(uw, r, nil)
 	if err != nil {
+		if uw.written {
+			// upgrader already replied with its own error response
+			reqctx.Set(ContextKeyHTTPResponseStarted, true)
+		}
+
 		return
 	}
 
+	if dc, ok := ws.(DeadlineConn); ok && server.writeTimeout > 0 {
+		ws = timeoutConn{
+			DeadlineConn: dc,
+			timeout:      server.writeTimeout,
+		}
+	}
+
 	reqctx.Set(ContextKeyWebsocketConnection, ws)
 	reqctx.Set(ContextKeyHTTPResponseStarted, true)
 
-	protocol := apollows.Protocol(ws.Subprotocol())
-
-	_, known := server.subscriptionProtocols[protocol]
+	protocol, known := server.subscriptionProtocols[ws.Subprotocol()]
 	if !known {
 		if ws != nil {
 			_ = ws.Close(int(apollows.EventCloseNormal), apollows.ErrUnknownProtocol.Error())
@@ -54,27 +122,40 @@ func (server *serverImpl) serveWebsocketRequest(
 		return apollows.ErrUnknownProtocol
 	}
 
+	buffer := server.connectionBuffer
+	if buffer < 1 {
+		buffer = 1
+	}
+
 	req := &websocketRequest{
 		protocol:   protocol,
 		ctx:        reqctx,
-		outgoing:   make(chan outgoingMessage, 1),
+		outgoing:   make(chan outgoingMessage, buffer),
+		pong:       make(chan struct{}, 1),
+		drained:    make(chan struct{}),
+		closing:    make(chan apollows.Error, 1),
 		operations: make(map[string]mutable.Context),
 		ws:         ws,
 		server:     server,
 	}
 
-	var tickerType apollows.Operation
+	if !server.register(req) {
+		code := server.shutdownCloseCode
 
-	switch req.protocol {
-	case apollows.WebsocketSubprotocolGraphqlWS:
-		tickerType = apollows.OperationKeepAlive
-	case apollows.WebsocketSubprotocolGraphqlTransportWS:
-		tickerType = apollows.OperationPong
+		_ = ws.Close(protocol.CloseCode(code), code.Error())
+
+		return ErrServerClosed
 	}
 
+	defer server.unregister(req)
+
+	drainedch := req.drained
+
+	tickerType := protocol.ServerOperation(apollows.ActionKeepalive)
+
 	var tickerch <-chan time.Time
 
-	if server.keepalive > 0 {
+	if server.keepalive > 0 && tickerType != "" {
 		ticker := time.NewTicker(server.keepalive)
 
 		defer func() {
@@ -84,6 +165,29 @@ func (server *serverImpl) serveWebsocketRequest(
 		tickerch = ticker.C
 	}
 
+	pingType := protocol.ServerOperation(apollows.ActionPing)
+
+	var (
+		pingch    <-chan time.Time
+		pongTimer *time.Timer
+		pongch    <-chan time.Time
+		closeerr  error
+	)
+
+	if server.pingInterval > 0 && server.pongTimeout > 0 && pingType != "" {
+		ticker := time.NewTicker(server.pingInterval)
+
+		pongTimer = time.NewTimer(server.pongTimeout)
+		pongTimer.Stop()
+
+		defer func() {
+			ticker.Stop()
+			pongTimer.Stop()
+		}()
+
+		pingch = ticker.C
+	}
+
 	go req.readWebsocket()
 
 	// req.outgoing is read to completion to avoid any potential blocking
@@ -92,6 +196,10 @@ func (server *serverImpl) serveWebsocketRequest(
 		select {
 		case msg, ok := <-req.outgoing:
 			if !ok {
+				if closeerr != nil {
+					return closeerr
+				}
+
 				return
 			}
 
@@ -99,60 +207,74 @@ func (server *serverImpl) serveWebsocketRequest(
 			case msg.Message != nil:
 				err = ws.WriteJSON(msg.Message)
 			case msg.Error != nil:
-				err = ws.Close(int(msg.Error.EventMessageType()), msg.Error.Error())
+				err = ws.Close(protocol.CloseCode(msg.Error), msg.Error.Error())
 			}
+		case <-drainedch:
+			drainedch = nil
+
+			err = req.closeDrained()
 		case <-tickerch:
 			err = ws.WriteJSON(&apollows.Message{
 				Type: tickerType,
 			})
-		}
-
-		if err != nil {
-			_ = ws.Close(int(apollows.EventCloseNormal), err.Error())
-		}
-	}
-}
+		case <-pingch:
+			// ping is only sent once previous one is answered
+			if pongch != nil {
+				continue
+			}
 
-func combineErrors(errs []gqlerrors.FormattedError) gqlerrors.FormattedError {
-	if len(errs) == 1 {
-		return errs[0]
-	}
+			err = ws.WriteJSON(&apollows.Message{
+				Type: pingType,
+			})
 
-	errmsg := "preparing operation"
+			pongTimer.Reset(server.pongTimeout)
+			pongch = pongTimer.C
+		case <-req.pong:
+			if pongch != nil && !pongTimer.Stop() {
+				<-pongTimer.C
+			}
 
-	var errmsgs []string
+			pongch = nil
+		case <-pongch:
+			pongch = nil
+			closeerr = apollows.EventPongTimeout
 
-	for _, err := range errs {
-		errmsgs = append(errmsgs, err.Error())
-	}
+			err = ws.Close(protocol.CloseCode(apollows.EventPongTimeout), apollows.EventPongTimeout.Error())
+			if err == nil {
+				continue
+			}
+		case awerr := <-req.closing:
+			closeerr = awerr
+
+			if t := protocol.ServerOperation(apollows.ActionConnectionError); t != "" {
+				_ = ws.WriteJSON(&apollows.Message{
+					Type: t,
+					Payload: apollows.Data{
+						Value: gqlerrors.FormatError(awerr),
+					},
+				})
+			}
 
-	if len(errmsgs) > 0 {
-		errmsg += ": " + strings.Join(errmsgs, "; ")
-	}
+			err = ws.Close(protocol.CloseCode(awerr), awerr.Error())
+			if err == nil {
+				continue
+			}
+		}
 
-	rooterr := gqlerrors.NewFormattedError(errmsg)
+		if err != nil {
+			if closeerr == nil && errors.Is(err, ErrWriteTimeout) {
+				closeerr = err
+			}
 
-	if len(errs) > 0 {
-		if (rooterr.Extensions) == nil {
-			rooterr.Extensions = make(map[string]interface{})
+			_ = ws.Close(int(apollows.EventCloseNormal), err.Error())
 		}
-
-		rooterr.Extensions["errors"] = errs
 	}
-
-	return rooterr
 }
 
 func (req *websocketRequest) handleError(ctx mutable.Context, err error, execution bool) {
 	awerr, ok := err.(apollows.Error)
 	if ok {
-		if req.protocol == apollows.WebsocketSubprotocolGraphqlWS {
-			req.writeWebsocketMessage(
-				ctx,
-				apollows.OperationConnectionError,
-				gqlerrors.FormatError(awerr),
-			)
-		}
+		req.writeWebsocketMessage(ctx, apollows.ActionConnectionError, gqlerrors.FormatError(awerr))
 
 		req.outgoing <- outgoingMessage{
 			Error: awerr,
@@ -164,52 +286,55 @@ func (req *websocketRequest) handleError(ctx mutable.Context, err error, executi
 	res, ok := err.(resultError)
 
 	if ok {
-		switch {
-		case execution:
+		if execution {
 			req.writeWebsocketData(ctx, res.Result)
-		case req.protocol == apollows.WebsocketSubprotocolGraphqlWS:
-			req.writeWebsocketMessage(ctx, apollows.OperationError, combineErrors(res.Result.Errors))
-		default:
-			req.writeWebsocketMessage(ctx, apollows.OperationError, res.Result.Errors)
+		} else {
+			req.writeWebsocketMessage(ctx, apollows.ActionError, req.protocol.FormatErrors(res.Result.Errors))
 		}
 
 		return
 	}
 
-	req.writeWebsocketMessage(ctx, apollows.OperationError, gqlerrors.FormatError(err))
+	req.writeWebsocketMessage(ctx, apollows.ActionError, gqlerrors.FormatError(err))
 }
 
 func (req *websocketRequest) writeWebsocketData(ctx mutable.Context, data *graphql.Result) {
-	var t apollows.Operation
-
-	switch req.protocol {
-	case apollows.WebsocketSubprotocolGraphqlWS:
-		t = apollows.OperationData
-	case apollows.WebsocketSubprotocolGraphqlTransportWS:
-		t = apollows.OperationNext
-
-		if ContextOperationStopped(ctx) {
-			return
-		}
+	if ContextOperationStopped(ctx) && !req.protocol.NotifyStopped() {
+		return
 	}
 
-	req.writeWebsocketMessage(ctx, t, data)
+	req.writeWebsocketMessage(ctx, apollows.ActionData, data)
 }
 
-func (req *websocketRequest) writeWebsocketMessage(ctx mutable.Context, t apollows.Operation, data interface{}) {
-	if t == apollows.OperationError {
+// writeWebsocketMessage sends message of type defined by the protocol for provided action, unless action is not
+// supported by the protocol
+func (req *websocketRequest) writeWebsocketMessage(ctx mutable.Context, a apollows.Action, data interface{}) {
+	if a == apollows.ActionError {
 		OperationContext(ctx).Set(ContextKeyOperationStopped, true)
 	}
 
+	t := req.protocol.ServerOperation(a)
+	if t == "" {
+		return
+	}
+
+	msg := &apollows.Message{
+		ID:   ContextOperationID(ctx),
+		Type: t,
+		Payload: apollows.Data{
+			Value: data,
+		},
+	}
+
+	if q, ok := ctx.Value(contextKeyOperationQueue).(*operationQueue); ok {
+		q.push(msg, a == apollows.ActionData)
+
+		return
+	}
+
 	select {
 	case req.outgoing <- outgoingMessage{
-		Message: &apollows.Message{
-			ID:   ContextOperationID(ctx),
-			Type: t,
-			Payload: apollows.Data{
-				Value: data,
-			},
-		},
+		Message: msg,
 	}:
 	case <-RequestContext(ctx).Done():
 	}
@@ -225,21 +350,23 @@ func (req *websocketRequest) readWebsocketInit(msg *apollows.Message) (err error
 		}
 	}
 
+	req.ctx.Set(ContextKeyPayloadInit, init)
+
 	err = req.server.callbacks.OnConnect(req.ctx, init)
 	if err != nil {
 		return
 	}
 
-	req.writeWebsocketMessage(req.ctx, apollows.OperationConnectionAck, nil)
+	req.m.Lock()
+	req.initPayload = init
+	req.m.Unlock()
+
+	req.writeWebsocketMessage(req.ctx, apollows.ActionConnectionAck, nil)
 
 	return
 }
 
 func (req *websocketRequest) readWebsocketStart(msg *apollows.Message) (err error) {
-	if !req.init && req.protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
-		return apollows.EventUnauthorized
-	}
-
 	req.m.RLock()
 	_, ok := req.operations[msg.ID]
 	req.m.RUnlock()
@@ -253,10 +380,51 @@ func (req *websocketRequest) readWebsocketStart(msg *apollows.Message) (err erro
 	opctx.Set(ContextKeyOperationContext, opctx)
 	opctx.Set(ContextKeyOperationID, msg.ID)
 
+	if _, rerr := req.server.takeRateLimit(opctx); rerr != nil {
+		req.handleError(opctx, rerr, false)
+		opctx.Cancel()
+
+		return
+	}
+
 	req.m.Lock()
+
+	if req.draining {
+		req.m.Unlock()
+
+		req.handleError(opctx, ErrServerClosed, false)
+		opctx.Cancel()
+
+		return
+	}
+
+	if limit := req.server.maxOperations; limit > 0 && len(req.operations) >= limit {
+		req.m.Unlock()
+
+		if req.server.maxOperationsPolicy == OperationLimitClose {
+			opctx.Cancel()
+
+			return apollows.EventTooManyOperations
+		}
+
+		req.handleError(opctx, ErrTooManyOperations, false)
+		opctx.Cancel()
+
+		return
+	}
+
 	req.operations[msg.ID] = opctx
+	req.ctx.Set(ContextKeyOperationCount, len(req.operations))
 	req.m.Unlock()
 
+	var q *operationQueue
+
+	if req.server.operationQueueEnabled() {
+		q = req.newOperationQueue(opctx)
+
+		opctx.Set(contextKeyOperationQueue, q)
+	}
+
 	req.wg.Add(1)
 
 	go func() {
@@ -266,15 +434,26 @@ func (req *websocketRequest) readWebsocketStart(msg *apollows.Message) (err erro
 			req.handleError(opctx, operr, executed)
 		}
 
-		if !ContextOperationStopped(opctx) ||
-			req.protocol == apollows.WebsocketSubprotocolGraphqlWS {
-			req.writeWebsocketMessage(opctx, apollows.OperationComplete, nil)
+		if !ContextOperationStopped(opctx) || req.protocol.NotifyStopped() {
+			req.writeWebsocketMessage(opctx, apollows.ActionComplete, nil)
+		}
+
+		if q != nil {
+			q.close()
 		}
 
 		opctx.Cancel()
 
 		req.m.Lock()
 		delete(req.operations, msg.ID)
+		req.ctx.Set(ContextKeyOperationCount, len(req.operations))
+
+		if req.draining && len(req.operations) == 0 {
+			req.drainedOnce.Do(func() {
+				close(req.drained)
+			})
+		}
+
 		req.m.Unlock()
 
 		req.wg.Done()
@@ -284,10 +463,6 @@ func (req *websocketRequest) readWebsocketStart(msg *apollows.Message) (err erro
 }
 
 func (req *websocketRequest) readWebsocketStop(msg *apollows.Message) (err error) {
-	if !req.init && req.protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
-		return apollows.EventUnauthorized
-	}
-
 	req.m.RLock()
 	prev, ok := req.operations[msg.ID]
 	req.m.RUnlock()
@@ -301,10 +476,6 @@ func (req *websocketRequest) readWebsocketStop(msg *apollows.Message) (err error
 }
 
 func (req *websocketRequest) readWebsocketTerminate() (err error) {
-	if req.protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
-		return apollows.EventUnauthorized
-	}
-
 	req.ctx.Set(ContextKeyOperationStopped, true)
 
 	req.outgoing <- outgoingMessage{
@@ -314,8 +485,15 @@ func (req *websocketRequest) readWebsocketTerminate() (err error) {
 	return
 }
 
+func (req *websocketRequest) readWebsocketPong() {
+	select {
+	case req.pong <- struct{}{}:
+	default:
+	}
+}
+
 func (req *websocketRequest) readWebsocketPing(msg *apollows.Message) {
-	req.writeWebsocketMessage(req.ctx, apollows.OperationPong, msg.Payload.Value)
+	req.writeWebsocketMessage(req.ctx, apollows.ActionPong, msg.Payload.Value)
 }
 
 func (req *websocketRequest) readWebsocket() {
@@ -357,8 +535,15 @@ func (req *websocketRequest) readWebsocket() {
 			return
 		}
 
-		switch msg.Type {
-		case apollows.OperationConnectionInit:
+		action := req.protocol.ClientAction(msg.Type)
+
+		err = req.protocol.Authorize(action, req.init)
+		if err != nil {
+			return
+		}
+
+		switch action {
+		case apollows.ActionConnectionInit:
 			if req.init {
 				err = apollows.EventTooManyInitializationRequests
 
@@ -372,14 +557,16 @@ func (req *websocketRequest) readWebsocket() {
 			if timer != nil {
 				timer.Stop()
 			}
-		case apollows.OperationStart, apollows.OperationSubscribe:
+		case apollows.ActionStart:
 			err = req.readWebsocketStart(&msg)
-		case apollows.OperationStop, apollows.OperationComplete:
+		case apollows.ActionStop:
 			err = req.readWebsocketStop(&msg)
-		case apollows.OperationTerminate:
+		case apollows.ActionConnectionTerminate:
 			err = req.readWebsocketTerminate()
-		case apollows.OperationPing:
+		case apollows.ActionPing:
 			req.readWebsocketPing(&msg)
+		case apollows.ActionPong:
+			req.readWebsocketPong()
 		}
 
 		if err != nil {
@@ -396,9 +583,7 @@ func (req *websocketRequest) serveWebsocketOperation(
 
 	err = json.Unmarshal(msg.Payload.RawMessage, &payload)
 	if err != nil {
-		if req.protocol == apollows.WebsocketSubprotocolGraphqlTransportWS {
-			err = apollows.WrapError(err, apollows.EventInvalidMessage)
-		}
+		err = req.protocol.InvalidMessageError(err)
 
 		return
 	}
@@ -412,6 +597,11 @@ func (req *websocketRequest) serveWebsocketOperation(
 		return
 	}
 
+	err = req.server.loadPersistedQuery(opctx, &payload)
+	if err != nil {
+		return
+	}
+
 	params, astdoc, subscription, result := req.server.parseAST(opctx, &payload)
 
 	err = req.server.callbacks.OnOperationValidation(opctx, &payload, result)
@@ -427,37 +617,36 @@ func (req *websocketRequest) serveWebsocketOperation(
 		return
 	}
 
-	var cres chan *graphql.Result
-
-	if subscription {
-		cres = graphql.ExecuteSubscription(graphql.ExecuteParams{
-			Schema:        req.server.schema,
-			Root:          req.server.rootObject,
-			AST:           astdoc,
-			OperationName: payload.OperationName,
-			Args:          payload.Variables,
-			Context:       params.Context,
-		})
-	} else {
-		cres = make(chan *graphql.Result, 1)
-		cres <- graphql.Execute(graphql.ExecuteParams{
-			Schema:        req.server.schema,
-			Root:          req.server.rootObject,
-			AST:           astdoc,
-			OperationName: payload.OperationName,
-			Args:          payload.Variables,
-			Context:       params.Context,
-		})
-		close(cres)
+	err = req.server.registerPersistedQuery(opctx)
+	if err != nil {
+		return
 	}
 
+	cres := req.server.execute(params, astdoc, subscription)
+
 	executed = true
 
-	var ok bool
+	var (
+		ok         bool
+		shutdownch <-chan struct{}
+	)
+
+	// subscriptions are completed on server shutdown, while queries and mutations are left to finish
+	if subscription {
+		shutdownch = req.server.connections.shutdown
+	}
 
 	for {
 		select {
+		case <-shutdownch:
+			return
 		case <-params.Context.Done():
+			if cancelled, ok := params.Context.Value(contextKeyOperationCancelled).(operationCancelled); ok {
+				err = cancelled.err
+
+				return
+			}
+
 			if !ContextOperationStopped(params.Context) {
 				err = params.Context.Err()
 			}
@@ -1,15 +1,19 @@
 package wsgraphql
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
 	"github.com/gorilla/websocket"
 	"github.com/graphql-go/graphql"
 	"github.com/stretchr/testify/assert"
@@ -960,6 +964,91 @@ func TestNewServerWebsocketOperationRestartGTWS(t *testing.T) {
 	assert.ErrorContains(t, err, "4409: Subscriber for 1 already exists")
 }
 
+func TestNewServerWebsocketMaxOperationsReject(t *testing.T) {
+	counts := make(chan int, 1)
+
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithMaxOperationsPerConnection(1, OperationLimitReject),
+		WithCallbacks(Callbacks{
+			OnOperation: func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+				counts <- ContextOperationCount(opctx)
+
+				return nil
+			},
+		}),
+	)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, id := range []string{"1", "2"} {
+		err := conn.WriteJSON(apollows.Message{
+			ID:   id,
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `subscription { forever }`,
+				},
+			},
+		})
+
+		assert.NoError(t, err)
+	}
+
+	var msg apollows.Message
+
+	err := conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationError, msg.Type)
+	assert.Equal(t, "2", msg.ID)
+	assert.Contains(t, string(msg.Payload.RawMessage), ErrTooManyOperations.Error())
+	assert.Equal(t, 1, <-counts)
+}
+
+func TestNewServerWebsocketMaxOperationsClose(t *testing.T) {
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithMaxOperationsPerConnection(1, OperationLimitClose),
+	)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	for _, id := range []string{"1", "2"} {
+		err := conn.WriteJSON(apollows.Message{
+			ID:   id,
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query: `subscription { forever }`,
+				},
+			},
+		})
+
+		assert.NoError(t, err)
+	}
+
+	var msg apollows.Message
+
+	err := conn.ReadJSON(&msg)
+
+	assert.ErrorContains(t, err, "4411: Too many operations")
+}
+
 func TestNewServerWebsocketOperationInvalidGWS(t *testing.T) {
 	srv := testNewServer(t, apollows.WebsocketSubprotocolGraphqlWS, WithConnectTimeout(time.Second))
 
@@ -1249,6 +1338,241 @@ func TestNewServerWebsocketPingGTWS(t *testing.T) {
 	assert.EqualValues(t, 123, m["foo"])
 }
 
+func TestNewServerWebsocketPongTimeoutGTWS(t *testing.T) {
+	disconnected := make(chan error, 1)
+
+	srv := testNewServer(
+		t,
+		apollows.WebsocketSubprotocolGraphqlTransportWS,
+		WithPing(time.Millisecond*10, time.Millisecond*50),
+		WithCallbacks(Callbacks{
+			OnDisconnect: func(reqctx mutable.Context, origerr error) error {
+				disconnected <- origerr
+
+				return origerr
+			},
+		}),
+	)
+
+	defer srv.Close()
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	conn, resp, err := websocket.DefaultDialer.Dial(u, http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	err = conn.WriteJSON(apollows.Message{
+		ID:      "",
+		Type:    apollows.OperationConnectionInit,
+		Payload: apollows.Data{},
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	// pings are sent regardless of initialization, so the first one may precede acknowledgement
+	for msg.Type != apollows.OperationConnectionAck {
+		err = conn.ReadJSON(&msg)
+
+		assert.NoError(t, err)
+
+		if msg.Type == apollows.OperationPing {
+			assert.NoError(t, conn.WriteJSON(apollows.Message{
+				Type: apollows.OperationPong,
+			}))
+		}
+	}
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationPing, msg.Type)
+
+	err = conn.WriteJSON(apollows.Message{
+		Type: apollows.OperationPong,
+	})
+
+	assert.NoError(t, err)
+
+	err = conn.ReadJSON(&msg)
+
+	assert.NoError(t, err)
+	assert.Equal(t, apollows.OperationPing, msg.Type)
+
+	err = conn.ReadJSON(&msg)
+
+	assert.ErrorContains(t, err, "4410: Pong timeout")
+
+	select {
+	case err = <-disconnected:
+		assert.ErrorIs(t, err, apollows.EventPongTimeout)
+	case <-time.After(time.Second):
+		assert.Fail(t, "disconnect not reported")
+	}
+}
+
+// testStuckUpgrader provides connections never delivering operation results, simulating stuck peer
+type testStuckUpgrader struct {
+	Upgrader
+}
+
+type testStuckConn struct {
+	DeadlineConn
+	deadline *time.Time
+}
+
+func (u testStuckUpgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (Conn, error) {
+	conn, err := u.Upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	return testStuckConn{
+		DeadlineConn: conn.(DeadlineConn),
+		deadline:     new(time.Time),
+	}, nil
+}
+
+func (conn testStuckConn) SetWriteDeadline(t time.Time) error {
+	*conn.deadline = t
+
+	return conn.DeadlineConn.SetWriteDeadline(t)
+}
+
+func (conn testStuckConn) WriteJSON(v interface{}) error {
+	if msg, ok := v.(*apollows.Message); ok && msg.Type == apollows.OperationNext {
+		time.Sleep(time.Until(*conn.deadline))
+
+		return os.ErrDeadlineExceeded
+	}
+
+	return conn.DeadlineConn.WriteJSON(v)
+}
+
+func TestNewServerWebsocketWriteTimeout(t *testing.T) {
+	disconnected := make(chan error, 1)
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithUpgrader(testStuckUpgrader{
+			Upgrader: NewStdUpgrader(apollows.WebsocketSubprotocolGraphqlTransportWS),
+		}),
+		WithWriteTimeout(time.Millisecond*10),
+		WithCallbacks(Callbacks{
+			OnDisconnect: func(reqctx mutable.Context, origerr error) error {
+				disconnected <- origerr
+
+				return origerr
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err = conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	var msg apollows.Message
+
+	err = conn.ReadJSON(&msg)
+
+	assert.Error(t, err)
+
+	select {
+	case err = <-disconnected:
+		assert.ErrorIs(t, err, ErrWriteTimeout)
+	case <-time.After(time.Second):
+		assert.Fail(t, "disconnect not reported")
+	}
+}
+
+type testPlainConn struct {
+	Conn
+}
+
+func TestWrapUpgraderWriteTimeout(t *testing.T) {
+	disconnected := make(chan error, 1)
+
+	server, err := NewServer(
+		testNewSchema(t),
+		WithUpgrader(WrapUpgrader(testStuckUpgrader{
+			Upgrader: NewStdUpgrader(apollows.WebsocketSubprotocolGraphqlTransportWS),
+		}, func(r *http.Request, conn Conn) Conn {
+			// hides write deadlines support of wrapped connection
+			return testPlainConn{
+				Conn: conn,
+			}
+		})),
+		WithWriteTimeout(time.Millisecond*10),
+		WithCallbacks(Callbacks{
+			OnDisconnect: func(reqctx mutable.Context, origerr error) error {
+				disconnected <- origerr
+
+				return origerr
+			},
+		}),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn := testConnectGTWS(t, srv)
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	err = conn.WriteJSON(apollows.Message{
+		ID:   "1",
+		Type: apollows.OperationSubscribe,
+		Payload: apollows.Data{
+			Value: apollows.PayloadOperation{
+				Query: `subscription { fooUpdates }`,
+			},
+		},
+	})
+
+	assert.NoError(t, err)
+
+	select {
+	case err = <-disconnected:
+		assert.ErrorIs(t, err, ErrWriteTimeout)
+	case <-time.After(time.Second):
+		assert.Fail(t, "disconnect not reported")
+	}
+}
+
 func TestNewServerWebsocketCombineErrorsGWS(t *testing.T) {
 	ex1 := &testExt{}
 	ex2 := &testExt{}
@@ -1356,3 +1680,134 @@ func TestNewServerWebsocketCombineErrorsGWS(t *testing.T) {
 	assert.NotNil(t, pd.Extensions["errors"])
 	assert.Len(t, pd.Extensions["errors"], 2)
 }
+
+func TestNewServerWebsocketDefaultUpgrader(t *testing.T) {
+	server, err := NewServer(testNewSchema(t))
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	testNewServerWebsocketGWS(t, srv)
+	testNewServerWebsocketGWTS(t, srv)
+
+	server, err = NewServer(testNewSchema(t), WithoutWebsocket())
+
+	assert.NoError(t, err)
+
+	srv2 := httptest.NewServer(server)
+
+	defer srv2.Close()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv2.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.Error(t, err)
+
+	if resp != nil {
+		_ = resp.Body.Close()
+	}
+}
+
+func TestNewServerWebsocketUpgradeRouting(t *testing.T) {
+	server, err := NewServer(testNewSchema(t))
+
+	assert.NoError(t, err)
+
+	var logbuf bytes.Buffer
+
+	srv := httptest.NewUnstartedServer(server)
+	srv.Config.ErrorLog = log.New(&logbuf, "", 0)
+
+	srv.Start()
+
+	// h2c upgrade request is served as plain one
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"query":"query { getFoo }"}`))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("connection", "Upgrade, HTTP2-Settings")
+	req.Header.Set("upgrade", "h2c")
+	req.Header.Set("http2-settings", "AAMAAABkAARAAAAAAAIAAAAA")
+
+	resp, err := http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+
+	var pd apollows.PayloadDataResponse
+
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pd))
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.EqualValues(t, 123, pd.Data["getFoo"])
+
+	// malformed websocket upgrade is rejected by upgrader only, error is not written again
+	req, err = http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	assert.NoError(t, err)
+
+	req.Header.Set("connection", "upgrade")
+	req.Header.Set("upgrade", "websocket")
+
+	resp, err = http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+
+	srv.Close()
+
+	assert.NotContains(t, logbuf.String(), "superfluous")
+}
+
+type testCustomProtocol struct {
+	apollows.Protocol
+}
+
+func (testCustomProtocol) String() string {
+	return "custom-ws"
+}
+
+func (p testCustomProtocol) ServerOperation(a apollows.Action) apollows.Operation {
+	if a == apollows.ActionKeepalive {
+		return "heartbeat"
+	}
+
+	return p.Protocol.ServerOperation(a)
+}
+
+func TestNewServerWebsocketCustomProtocol(t *testing.T) {
+	server, err := NewServer(
+		testNewSchema(t),
+		WithProtocol(testCustomProtocol{Protocol: apollows.WebsocketSubprotocolGraphqlTransportWS}),
+		WithKeepalive(time.Millisecond*10),
+	)
+
+	assert.NoError(t, err)
+
+	srv := httptest.NewServer(server)
+
+	defer srv.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{"custom-ws"},
+	})
+
+	assert.NoError(t, err)
+
+	defer func() {
+		_ = conn.Close()
+		_ = resp.Body.Close()
+	}()
+
+	assert.Equal(t, "custom-ws", conn.Subprotocol())
+
+	var msg apollows.Message
+
+	assert.NoError(t, conn.ReadJSON(&msg))
+	assert.Equal(t, apollows.Operation("heartbeat"), msg.Type)
+}
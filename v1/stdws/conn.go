@@ -0,0 +1,394 @@
+package stdws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Message types, as defined by RFC 6455 opcodes
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+
+	continuationFrame = 0
+)
+
+// Close codes, as defined by RFC 6455
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseAbnormalClosure  = 1006
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+	CloseServiceRestart   = 1012
+)
+
+// DefaultReadLimit is maximum size of a message read from the peer, unless configured otherwise
+const DefaultReadLimit = 32 << 20
+
+const (
+	finalBit = 0x80
+	rsvBits  = 0x70
+	maskBit  = 0x80
+
+	maxControlPayload = 125
+)
+
+var (
+	// ErrReadLimit returned when peer sends message exceeding the read limit
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+
+	// ErrCloseSent returned when attempting to write after close message was sent
+	ErrCloseSent = errors.New("websocket: close sent")
+
+	errProtocol       = errors.New("websocket: protocol error")
+	errInvalidUTF8    = errors.New("websocket: invalid UTF-8 in text message")
+	errInvalidControl = errors.New("websocket: invalid control frame")
+)
+
+// CloseError is returned when close message is received from the peer
+type CloseError struct {
+	Text string
+	Code int
+}
+
+// Error implementation
+func (e *CloseError) Error() string {
+	return "websocket: close " + strconv.Itoa(e.Code) + " " + e.Text
+}
+
+// Conn is a server-side websocket connection. Reads are expected to be done by a single goroutine, writes are safe
+// for concurrent use.
+type Conn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	pongHandler func(appData string) error
+	subprotocol string
+	readLimit   int64
+	wm          sync.Mutex
+	closeSent   bool
+}
+
+// Subprotocol returns negotiated websocket subprotocol
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// NetConn returns underlying network connection
+func (c *Conn) NetConn() net.Conn {
+	return c.conn
+}
+
+// SetReadDeadline sets deadline for future reads from the connection
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets deadline for future writes to the connection
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetPongHandler sets handler called for pong messages received while reading, must be set before reads begin
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	c.pongHandler = h
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.wm.Lock()
+	defer c.wm.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 2, 10)
+
+	header[0] = finalBit | opcode
+
+	switch n := len(payload); {
+	case n <= maxControlPayload:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+
+	_, err := c.conn.Write(append(header, payload...))
+
+	return err
+}
+
+// WriteMessage writes a single unfragmented message of provided type
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	switch messageType {
+	case CloseMessage, PingMessage, PongMessage:
+		if len(data) > maxControlPayload {
+			return errInvalidControl
+		}
+	}
+
+	return c.writeFrame(byte(messageType), data)
+}
+
+// WritePing writes ping message with provided application data
+func (c *Conn) WritePing(data []byte) error {
+	return c.WriteMessage(PingMessage, data)
+}
+
+// WriteJSON writes JSON encoded value as a text message
+func (c *Conn) WriteJSON(v interface{}) error {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.WriteMessage(TextMessage, bs)
+}
+
+// ReadJSON reads next data message and decodes it as JSON into v
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, bs, err := c.ReadMessage()
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bs, v)
+}
+
+// FormatCloseMessage returns close message payload for provided code and text, text is truncated to fit control
+// frame payload limit
+func FormatCloseMessage(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+
+	if len(text) > maxControlPayload-2 {
+		text = text[:maxControlPayload-2]
+
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+
+	bs := make([]byte, 2, 2+len(text))
+
+	binary.BigEndian.PutUint16(bs, uint16(code))
+
+	return append(bs, text...)
+}
+
+// Close sends close message with provided code and text, if not sent yet, and closes underlying connection
+func (c *Conn) Close(code int, message string) error {
+	origerr := c.writeFrame(CloseMessage, FormatCloseMessage(code, message))
+	if origerr == ErrCloseSent {
+		origerr = nil
+	}
+
+	err := c.conn.Close()
+	if err == nil {
+		err = origerr
+	}
+
+	return err
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	default:
+		return false
+	}
+}
+
+// fail sends close message with provided code in response to a misbehaving peer, returning original error
+func (c *Conn) fail(code int, err error) error {
+	_ = c.writeFrame(CloseMessage, FormatCloseMessage(code, err.Error()))
+
+	return err
+}
+
+type frame struct {
+	payload []byte
+	opcode  byte
+	final   bool
+}
+
+func (c *Conn) readFrame(remaining int64) (f frame, err error) {
+	var header [2]byte
+
+	_, err = io.ReadFull(c.br, header[:])
+	if err != nil {
+		return
+	}
+
+	f.final = header[0]&finalBit != 0
+	f.opcode = header[0] & 0x0f
+
+	if header[0]&rsvBits != 0 || header[1]&maskBit == 0 {
+		return f, c.fail(CloseProtocolError, errProtocol)
+	}
+
+	length := int64(header[1] &^ maskBit)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+
+		_, err = io.ReadFull(c.br, ext[:])
+		if err != nil {
+			return
+		}
+
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+
+		_, err = io.ReadFull(c.br, ext[:])
+		if err != nil {
+			return
+		}
+
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+		if length < 0 {
+			return f, c.fail(CloseProtocolError, errProtocol)
+		}
+	}
+
+	if f.opcode >= CloseMessage && (length > maxControlPayload || !f.final) {
+		return f, c.fail(CloseProtocolError, errInvalidControl)
+	}
+
+	if f.opcode < CloseMessage && length > remaining {
+		return f, c.fail(CloseMessageTooBig, ErrReadLimit)
+	}
+
+	var mask [4]byte
+
+	_, err = io.ReadFull(c.br, mask[:])
+	if err != nil {
+		return
+	}
+
+	f.payload = make([]byte, length)
+
+	_, err = io.ReadFull(c.br, f.payload)
+	if err != nil {
+		return
+	}
+
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+
+	return f, nil
+}
+
+func (c *Conn) readClose(payload []byte) error {
+	code, text := CloseNoStatusReceived, ""
+
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, errInvalidControl)
+	case len(payload) >= 2:
+		code = int(binary.BigEndian.Uint16(payload))
+		text = string(payload[2:])
+
+		if !validCloseCode(code) {
+			return c.fail(CloseProtocolError, errInvalidControl)
+		}
+
+		if !utf8.ValidString(text) {
+			return c.fail(CloseInvalidPayload, errInvalidUTF8)
+		}
+	}
+
+	// echo close code back to complete closing handshake
+	_ = c.writeFrame(CloseMessage, FormatCloseMessage(code, ""))
+
+	return &CloseError{
+		Code: code,
+		Text: text,
+	}
+}
+
+// ReadMessage reads next data message, reassembling fragmented messages and handling control messages in between
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	for {
+		var f frame
+
+		f, err = c.readFrame(c.readLimit - int64(len(data)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case CloseMessage:
+			return 0, nil, c.readClose(f.payload)
+		case PingMessage:
+			err = c.writeFrame(PongMessage, f.payload)
+			if err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+		case PongMessage:
+			if c.pongHandler != nil {
+				err = c.pongHandler(string(f.payload))
+				if err != nil {
+					return 0, nil, err
+				}
+			}
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.fail(CloseProtocolError, errProtocol)
+			}
+
+			messageType, data = int(f.opcode), f.payload
+		case continuationFrame:
+			if messageType == 0 {
+				return 0, nil, c.fail(CloseProtocolError, errProtocol)
+			}
+
+			data = append(data, f.payload...)
+		default:
+			return 0, nil, c.fail(CloseProtocolError, errProtocol)
+		}
+
+		if messageType == 0 || !f.final || f.opcode >= CloseMessage {
+			continue
+		}
+
+		if messageType == TextMessage && !utf8.Valid(data) {
+			return 0, nil, c.fail(CloseInvalidPayload, errInvalidUTF8)
+		}
+
+		return messageType, data, nil
+	}
+}
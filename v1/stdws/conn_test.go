@@ -0,0 +1,245 @@
+package stdws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func testNewServer(t *testing.T, upgrader *Upgrader, serve func(c *Conn)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, http.Header{
+			"X-Foo": []string{"bar"},
+		})
+		if err != nil {
+			return
+		}
+
+		serve(c)
+	}))
+}
+
+func testDial(t *testing.T, srv *httptest.Server, dialer *websocket.Dialer, header http.Header) *websocket.Conn {
+	c, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", resp.Header.Get("x-foo"))
+	assert.NoError(t, resp.Body.Close())
+
+	return c
+}
+
+func testEcho(c *Conn) {
+	for {
+		mt, bs, err := c.ReadMessage()
+		if err != nil {
+			_ = c.Close(CloseNormalClosure, "")
+
+			return
+		}
+
+		err = c.WriteMessage(mt, bs)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestUpgraderEcho(t *testing.T) {
+	srv := testNewServer(t, &Upgrader{
+		Subprotocols: []string{"foo", "bar"},
+	}, testEcho)
+
+	defer srv.Close()
+
+	// small write buffer forces client to fragment large messages
+	c := testDial(t, srv, &websocket.Dialer{WriteBufferSize: 256}, http.Header{
+		"Sec-WebSocket-Protocol": []string{"baz, bar"},
+	})
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	assert.Equal(t, "bar", c.Subprotocol())
+
+	large := strings.Repeat("x", 100000)
+
+	for _, msg := range []string{"hello", "", large} {
+		assert.NoError(t, c.WriteMessage(websocket.TextMessage, []byte(msg)))
+
+		mt, bs, err := c.ReadMessage()
+
+		assert.NoError(t, err)
+		assert.Equal(t, websocket.TextMessage, mt)
+		assert.Equal(t, msg, string(bs))
+	}
+
+	assert.NoError(t, c.WriteMessage(websocket.BinaryMessage, []byte{0, 1, 2}))
+
+	mt, bs, err := c.ReadMessage()
+
+	assert.NoError(t, err)
+	assert.Equal(t, websocket.BinaryMessage, mt)
+	assert.Equal(t, []byte{0, 1, 2}, bs)
+
+	pong := make(chan string, 1)
+
+	c.SetPongHandler(func(appData string) error {
+		pong <- appData
+
+		return nil
+	})
+
+	assert.NoError(t, c.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(time.Second)))
+	assert.NoError(t, c.WriteMessage(websocket.TextMessage, []byte("after ping")))
+
+	_, bs, err = c.ReadMessage()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "after ping", string(bs))
+	assert.Equal(t, "ping", <-pong)
+
+	assert.NoError(t, c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4000, "bye")))
+
+	_, _, err = c.ReadMessage()
+
+	assert.True(t, websocket.IsCloseError(err, 4000))
+}
+
+func TestUpgraderJSON(t *testing.T) {
+	pong := make(chan string, 1)
+
+	srv := testNewServer(t, &Upgrader{}, func(c *Conn) {
+		c.SetPongHandler(func(appData string) error {
+			pong <- appData
+
+			return nil
+		})
+
+		assert.Equal(t, "", c.Subprotocol())
+		assert.NoError(t, c.WritePing([]byte("srv")))
+
+		var v map[string]interface{}
+
+		assert.NoError(t, c.ReadJSON(&v))
+		assert.NoError(t, c.WriteJSON(v))
+
+		// pong is received before the next message
+		_, bs, err := c.ReadMessage()
+
+		assert.NoError(t, err)
+		assert.Equal(t, "done", string(bs))
+		assert.Equal(t, "srv", <-pong)
+		assert.NoError(t, c.Close(4400, strings.Repeat("y", 200)))
+	})
+
+	defer srv.Close()
+
+	c := testDial(t, srv, websocket.DefaultDialer, nil)
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	assert.NoError(t, c.WriteJSON(map[string]interface{}{"foo": "bar"}))
+
+	var v map[string]interface{}
+
+	assert.NoError(t, c.ReadJSON(&v))
+	assert.Equal(t, "bar", v["foo"])
+	assert.NoError(t, c.WriteMessage(websocket.TextMessage, []byte("done")))
+
+	_, _, err := c.ReadMessage()
+
+	var cerr *websocket.CloseError
+
+	assert.ErrorAs(t, err, &cerr)
+	assert.Equal(t, 4400, cerr.Code)
+	assert.Len(t, cerr.Text, 123)
+}
+
+func TestUpgraderReadLimit(t *testing.T) {
+	srv := testNewServer(t, &Upgrader{
+		ReadLimit: 10,
+	}, testEcho)
+
+	defer srv.Close()
+
+	c := testDial(t, srv, websocket.DefaultDialer, nil)
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	assert.NoError(t, c.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 11))))
+
+	_, _, err := c.ReadMessage()
+
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseMessageTooBig))
+}
+
+func TestUpgraderInvalidUTF8(t *testing.T) {
+	srv := testNewServer(t, &Upgrader{}, testEcho)
+
+	defer srv.Close()
+
+	c := testDial(t, srv, websocket.DefaultDialer, nil)
+
+	defer func() {
+		_ = c.Close()
+	}()
+
+	assert.NoError(t, c.WriteMessage(websocket.TextMessage, []byte{0xff, 0xfe}))
+
+	_, _, err := c.ReadMessage()
+
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData))
+}
+
+func TestUpgraderHandshake(t *testing.T) {
+	srv := testNewServer(t, &Upgrader{}, testEcho)
+
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	u := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	_, resp, err = websocket.DefaultDialer.Dial(u, http.Header{
+		"Origin": []string{"http://example.com"},
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+
+	assert.NoError(t, err)
+
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "8")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+
+	resp, err = http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	assert.Equal(t, "13", resp.Header.Get("sec-websocket-version"))
+	assert.NoError(t, resp.Body.Close())
+}
+
+func TestAcceptKey(t *testing.T) {
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", acceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+}
@@ -0,0 +1,197 @@
+// Package stdws provides RFC 6455 websocket server implementation based on standard library only, without
+// dependency on any third-party websocket modules
+package stdws
+
+import (
+	"bufio"
+	"crypto/sha1" //nolint:gosec // mandated by RFC 6455 handshake
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrBadHandshake returned when request is not a valid websocket handshake
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+
+	// ErrOriginNotAllowed returned when request origin is rejected
+	ErrOriginNotAllowed = errors.New("websocket: request origin not allowed")
+
+	// ErrHijackNotSupported returned when response writer does not implement http.Hijacker
+	ErrHijackNotSupported = errors.New("websocket: response does not implement http.Hijacker")
+)
+
+// Upgrader upgrades HTTP requests to websocket connections
+type Upgrader struct {
+	// CheckOrigin returns true if request origin is acceptable, by default cross-origin requests are rejected
+	CheckOrigin func(r *http.Request) bool
+
+	// Subprotocols supported by the server in order of preference
+	Subprotocols []string
+
+	// ReadLimit is maximum size of a message read from the peer, DefaultReadLimit is used if not set
+	ReadLimit int64
+}
+
+func headerContainsToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request) string {
+	var requested []string
+
+	for _, value := range r.Header.Values("sec-websocket-protocol") {
+		for _, part := range strings.Split(value, ",") {
+			requested = append(requested, strings.TrimSpace(part))
+		}
+	}
+
+	for _, supported := range u.Subprotocols {
+		for _, protocol := range requested {
+			if protocol == supported {
+				return protocol
+			}
+		}
+	}
+
+	return ""
+}
+
+func acceptKey(key string) string {
+	h := sha1.New() //nolint:gosec // mandated by RFC 6455 handshake
+
+	_, _ = h.Write([]byte(key + websocketGUID))
+
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func fail(w http.ResponseWriter, status int, err error) error {
+	http.Error(w, http.StatusText(status), status)
+
+	return err
+}
+
+// Upgrade performs websocket handshake, hijacking underlying connection. On failure HTTP error response is written.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContainsToken(r.Header, "connection", "upgrade") ||
+		!headerContainsToken(r.Header, "upgrade", "websocket") {
+		return nil, fail(w, http.StatusBadRequest, ErrBadHandshake)
+	}
+
+	if r.Header.Get("sec-websocket-version") != "13" {
+		w.Header().Set("sec-websocket-version", "13")
+
+		return nil, fail(w, http.StatusUpgradeRequired, ErrBadHandshake)
+	}
+
+	key := r.Header.Get("sec-websocket-key")
+
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, fail(w, http.StatusBadRequest, ErrBadHandshake)
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+
+	if !checkOrigin(r) {
+		return nil, fail(w, http.StatusForbidden, ErrOriginNotAllowed)
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fail(w, http.StatusInternalServerError, ErrHijackNotSupported)
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// deadlines might have been set by http.Server
+	_ = netConn.SetDeadline(time.Time{})
+
+	var sb strings.Builder
+
+	sb.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	sb.WriteString("Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n")
+
+	if subprotocol != "" {
+		sb.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+
+	for k, vs := range responseHeader {
+		switch http.CanonicalHeaderKey(k) {
+		case "Sec-Websocket-Protocol", "Sec-Websocket-Extensions":
+			continue
+		}
+
+		for _, v := range vs {
+			sb.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+
+	sb.WriteString("\r\n")
+
+	_, err = brw.Writer.WriteString(sb.String())
+	if err == nil {
+		err = brw.Writer.Flush()
+	}
+
+	if err != nil {
+		_ = netConn.Close()
+
+		return nil, err
+	}
+
+	return newConn(netConn, brw.Reader, subprotocol, u.ReadLimit), nil
+}
+
+func newConn(netConn net.Conn, br *bufio.Reader, subprotocol string, readLimit int64) *Conn {
+	if br == nil {
+		br = bufio.NewReader(netConn)
+	}
+
+	if readLimit <= 0 {
+		readLimit = DefaultReadLimit
+	}
+
+	return &Conn{
+		conn:        netConn,
+		br:          br,
+		subprotocol: subprotocol,
+		readLimit:   readLimit,
+	}
+}
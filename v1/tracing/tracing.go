@@ -0,0 +1,320 @@
+// Package tracing provides OpenTelemetry tracing of HTTP requests / websocket connections, operations, their parse and
+// validation phases and emitted subscription results
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/bitquery/wsgraphql/v1/mutable"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is instrumentation name of the tracer
+const TracerName = "github.com/bitquery/wsgraphql/v1/tracing"
+
+// Tracing creates spans for server requests and operations.
+// Both should be used: extension to be added to the schema with graphql.Schema.AddExtensions before creating the
+// server, providing parse and validation spans and making operation span available to resolvers, and callbacks
+// providing request, operation and subscription result spans.
+type Tracing interface {
+	graphql.Extension
+
+	// Callbacks returns callbacks creating spans, calling provided ones
+	Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks
+}
+
+type tracingConfig struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// Option to configure Tracing
+type Option func(config *tracingConfig) error
+
+// WithTracerProvider option sets tracer provider, global one is used by default
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(config *tracingConfig) error {
+		config.provider = provider
+
+		return nil
+	}
+}
+
+// WithPropagator option sets propagator extracting parent span context from HTTP request headers and operation
+// extensions, W3C trace context is used by default
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(config *tracingConfig) error {
+		config.propagator = propagator
+
+		return nil
+	}
+}
+
+type (
+	contextKeyRequestSpanT   struct{}
+	contextKeyOperationSpanT struct{}
+)
+
+var (
+	contextKeyRequestSpan   = contextKeyRequestSpanT{}
+	contextKeyOperationSpan = contextKeyOperationSpanT{}
+)
+
+type tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New returns new Tracing instance
+func New(options ...Option) (Tracing, error) {
+	config := tracingConfig{
+		provider:   otel.GetTracerProvider(),
+		propagator: propagation.TraceContext{},
+	}
+
+	for _, o := range options {
+		err := o(&config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &tracing{
+		tracer:     config.provider.Tracer(TracerName),
+		propagator: config.propagator,
+	}, nil
+}
+
+func spanFrom(ctx context.Context, key interface{}) trace.Span {
+	span, ok := ctx.Value(key).(trace.Span)
+	if !ok {
+		return nil
+	}
+
+	return span
+}
+
+func finish(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// extensionsCarrier exposes string values of operation extensions, such as traceparent, to propagator
+func extensionsCarrier(extensions map[string]interface{}) propagation.MapCarrier {
+	carrier := make(propagation.MapCarrier)
+
+	for k, v := range extensions {
+		if s, ok := v.(string); ok {
+			carrier[k] = s
+		}
+	}
+
+	return carrier
+}
+
+func operationName(payload *apollows.PayloadOperation) string {
+	if payload.OperationName != "" {
+		return payload.OperationName
+	}
+
+	return "graphql.operation"
+}
+
+func (t *tracing) startRequest(reqctx mutable.Context, r *http.Request) {
+	ctx := t.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+	_, span := t.tracer.Start(
+		ctx,
+		"graphql.request",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("client.address", r.RemoteAddr),
+		),
+	)
+
+	reqctx.Set(contextKeyRequestSpan, span)
+}
+
+func (t *tracing) startOperation(opctx mutable.Context, payload *apollows.PayloadOperation) {
+	ctx := context.Context(opctx)
+
+	var opts []trace.SpanStartOption
+
+	if reqspan := spanFrom(opctx, contextKeyRequestSpan); reqspan != nil {
+		ctx = trace.ContextWithSpan(ctx, reqspan)
+	}
+
+	// parent provided by the client takes precedence, request span is linked instead
+	remote := t.propagator.Extract(ctx, extensionsCarrier(payload.Extensions))
+
+	if trace.SpanContextFromContext(remote).IsValid() {
+		opts = append(opts, trace.WithLinks(trace.LinkFromContext(ctx)))
+		ctx = remote
+	}
+
+	_, span := t.tracer.Start(ctx, operationName(payload), opts...)
+
+	opctx.Set(contextKeyOperationSpan, span)
+}
+
+func (t *tracing) Callbacks(next wsgraphql.Callbacks) wsgraphql.Callbacks {
+	res := next
+
+	res.OnRequest = func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter) error {
+		t.startRequest(reqctx, r)
+
+		if next.OnRequest != nil {
+			return next.OnRequest(reqctx, r, w)
+		}
+
+		return nil
+	}
+
+	res.OnRequestDone = func(reqctx mutable.Context, r *http.Request, w http.ResponseWriter, origerr error) {
+		if span := spanFrom(reqctx, contextKeyRequestSpan); span != nil {
+			if conn := wsgraphql.ContextWebsocketConnection(reqctx); conn != nil {
+				span.SetAttributes(attribute.String("graphql.websocket.protocol", conn.Subprotocol()))
+			}
+
+			finish(span, origerr)
+		}
+
+		if next.OnRequestDone != nil {
+			next.OnRequestDone(reqctx, r, w, origerr)
+		} else {
+			wsgraphql.WriteError(reqctx, w, origerr)
+		}
+	}
+
+	res.OnOperation = func(opctx mutable.Context, payload *apollows.PayloadOperation) error {
+		t.startOperation(opctx, payload)
+
+		var err error
+
+		if next.OnOperation != nil {
+			err = next.OnOperation(opctx, payload)
+		}
+
+		// payload could be modified by the callback
+		if span := spanFrom(opctx, contextKeyOperationSpan); span != nil {
+			span.SetName(operationName(payload))
+			span.SetAttributes(
+				attribute.String("graphql.operation.id", wsgraphql.ContextOperationID(opctx)),
+				attribute.String("graphql.operation.name", payload.OperationName),
+			)
+		}
+
+		return err
+	}
+
+	res.OnOperationResult = func(
+		opctx mutable.Context,
+		payload *apollows.PayloadOperation,
+		result *graphql.Result,
+	) error {
+		if span := spanFrom(opctx, contextKeyOperationSpan); span != nil && wsgraphql.ContextSubscription(opctx) {
+			_, rspan := t.tracer.Start(trace.ContextWithSpan(opctx, span), "graphql.result")
+
+			if result != nil && result.HasErrors() {
+				rspan.SetStatus(codes.Error, result.Errors[0].Message)
+			}
+
+			rspan.End()
+		}
+
+		if next.OnOperationResult != nil {
+			return next.OnOperationResult(opctx, payload, result)
+		}
+
+		return nil
+	}
+
+	res.OnOperationDone = func(opctx mutable.Context, payload *apollows.PayloadOperation, origerr error) error {
+		if next.OnOperationDone != nil {
+			origerr = next.OnOperationDone(opctx, payload, origerr)
+		}
+
+		if span := spanFrom(opctx, contextKeyOperationSpan); span != nil {
+			finish(span, origerr)
+		}
+
+		return origerr
+	}
+
+	return res
+}
+
+// Init makes operation span available to resolvers
+func (t *tracing) Init(ctx context.Context, p *graphql.Params) context.Context {
+	if span := spanFrom(ctx, contextKeyOperationSpan); span != nil {
+		return trace.ContextWithSpan(ctx, span)
+	}
+
+	return ctx
+}
+
+func (t *tracing) Name() string {
+	return TracerName
+}
+
+func (t *tracing) ParseDidStart(ctx context.Context) (context.Context, graphql.ParseFinishFunc) {
+	if spanFrom(ctx, contextKeyOperationSpan) == nil {
+		return ctx, func(err error) {}
+	}
+
+	_, span := t.tracer.Start(ctx, "graphql.parse")
+
+	return ctx, func(err error) {
+		finish(span, err)
+	}
+}
+
+func (t *tracing) ValidationDidStart(ctx context.Context) (context.Context, graphql.ValidationFinishFunc) {
+	if spanFrom(ctx, contextKeyOperationSpan) == nil {
+		return ctx, func(errs []gqlerrors.FormattedError) {}
+	}
+
+	_, span := t.tracer.Start(ctx, "graphql.validate")
+
+	return ctx, func(errs []gqlerrors.FormattedError) {
+		if len(errs) > 0 {
+			span.SetStatus(codes.Error, errs[0].Message)
+		}
+
+		span.End()
+	}
+}
+
+func (t *tracing) ExecutionDidStart(ctx context.Context) (context.Context, graphql.ExecutionFinishFunc) {
+	return ctx, func(result *graphql.Result) {}
+}
+
+func (t *tracing) ResolveFieldDidStart(
+	ctx context.Context,
+	info *graphql.ResolveInfo,
+) (context.Context, graphql.ResolveFieldFinishFunc) {
+	return ctx, func(v interface{}, err error) {}
+}
+
+func (t *tracing) HasResult() bool {
+	return false
+}
+
+func (t *tracing) GetResult(ctx context.Context) interface{} {
+	return nil
+}
@@ -0,0 +1,187 @@
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bitquery/wsgraphql/v1"
+	"github.com/bitquery/wsgraphql/v1/apollows"
+	"github.com/gorilla/websocket"
+	"github.com/graphql-go/graphql"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceparent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+func testNewServer(t *testing.T) (*httptest.Server, *tracetest.SpanRecorder, chan trace.SpanContext) {
+	resolved := make(chan trace.SpanContext, 1)
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "QueryRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						resolved <- trace.SpanContextFromContext(p.Context)
+
+						return 1, nil
+					},
+				},
+			},
+		}),
+		Subscription: graphql.NewObject(graphql.ObjectConfig{
+			Name: "SubscriptionRoot",
+			Fields: graphql.Fields{
+				"foo": &graphql.Field{
+					Type: graphql.Int,
+					Subscribe: func(p graphql.ResolveParams) (interface{}, error) {
+						ch := make(chan interface{}, 2)
+
+						ch <- 1
+						ch <- 2
+
+						close(ch)
+
+						return ch, nil
+					},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return p.Source, nil
+					},
+				},
+			},
+		}),
+	})
+
+	assert.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+
+	tr, err := New(WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	assert.NoError(t, err)
+
+	schema.AddExtensions(tr)
+
+	server, err := wsgraphql.NewServer(schema, wsgraphql.WithCallbacks(tr.Callbacks(wsgraphql.Callbacks{})))
+
+	assert.NoError(t, err)
+
+	return httptest.NewServer(server), recorder, resolved
+}
+
+func testSpans(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	return spans
+}
+
+func TestTracingPlain(t *testing.T) {
+	srv, recorder, resolved := testNewServer(t)
+
+	defer srv.Close()
+
+	body := `{"query":"query Foo { foo }","operationName":"Foo"}`
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+
+	assert.NoError(t, err)
+
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("traceparent", testTraceparent)
+
+	resp, err := http.DefaultClient.Do(req)
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	// request span ends after response is written
+	for i := 0; i < 100 && testSpans(recorder)["graphql.request"] == nil; i++ {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	spans := testSpans(recorder)
+
+	request, operation := spans["graphql.request"], spans["Foo"]
+
+	if !assert.NotNil(t, request) || !assert.NotNil(t, operation) {
+		return
+	}
+
+	assert.Equal(t, testTraceID, request.SpanContext().TraceID().String())
+	assert.Equal(t, request.SpanContext().SpanID(), operation.Parent().SpanID())
+	assert.Equal(t, operation.SpanContext().SpanID(), spans["graphql.parse"].Parent().SpanID())
+	assert.Equal(t, operation.SpanContext().SpanID(), spans["graphql.validate"].Parent().SpanID())
+	assert.Equal(t, operation.SpanContext().SpanID(), (<-resolved).SpanID())
+}
+
+func TestTracingWebsocket(t *testing.T) {
+	srv, recorder, _ := testNewServer(t)
+
+	defer srv.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{
+		"sec-websocket-protocol": []string{apollows.WebsocketSubprotocolGraphqlTransportWS.String()},
+	})
+
+	assert.NoError(t, err)
+	assert.NoError(t, resp.Body.Close())
+
+	for _, msg := range []apollows.Message{
+		{
+			Type:    apollows.OperationConnectionInit,
+			Payload: apollows.Data{},
+		},
+		{
+			ID:   "1",
+			Type: apollows.OperationSubscribe,
+			Payload: apollows.Data{
+				Value: apollows.PayloadOperation{
+					Query:         `subscription Sub { foo }`,
+					OperationName: "Sub",
+					Extensions:    map[string]interface{}{"traceparent": testTraceparent},
+				},
+			},
+		},
+	} {
+		assert.NoError(t, conn.WriteJSON(msg))
+	}
+
+	var msg apollows.Message
+
+	for msg.Type != apollows.OperationComplete {
+		assert.NoError(t, conn.ReadJSON(&msg))
+	}
+
+	_ = conn.Close()
+
+	var results int
+
+	for _, span := range recorder.Ended() {
+		if span.Name() == "graphql.result" {
+			results++
+		}
+	}
+
+	assert.Equal(t, 2, results)
+
+	operation := testSpans(recorder)["Sub"]
+
+	if assert.NotNil(t, operation) {
+		assert.Equal(t, testTraceID, operation.SpanContext().TraceID().String())
+		assert.Len(t, operation.Links(), 1)
+	}
+}